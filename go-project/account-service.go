@@ -182,6 +182,7 @@ func Deposit(body *DepositRequest, userId uint) error {
 	return nil
 }
 
+// BuyQuiz pins the latest revision of the quiz for the buyer and pays the seller
 func BuyQuiz(body *BuyQuizRequest, userId uint) error {
 	acc, err := Db.GetAccountById(userId)
 	if err != nil {
@@ -193,11 +194,20 @@ func BuyQuiz(body *BuyQuizRequest, userId uint) error {
 		return err
 	}
 
-	if product.Item.Owner.Id == acc.Id {
+	quiz, err := Db.GetQuizById(product.ItemId)
+	if err != nil {
+		return err
+	}
+
+	if quiz.OwnerId == acc.Id {
 		return errors.New("cannot buy quiz that you own")
 	}
 
-	if IsQuizExistingInAccount(acc, product.Item.Id) {
+	if quiz.Status != QuizPublished {
+		return ErrQuizNotPublished
+	}
+
+	if _, err := Db.GetPurchase(acc.Id, quiz.Id); err == nil {
 		return errors.New("account already owns the quiz")
 	}
 
@@ -205,11 +215,12 @@ func BuyQuiz(body *BuyQuizRequest, userId uint) error {
 		return errors.New("insufficient balance")
 	}
 
-	acc.Quizzes = append(acc.Quizzes, product.Item)
-
-	Db.PutAccount(acc)
+	purchase, err := newPurchase(acc.Id, quiz)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	return Db.PostPurchase(purchase, product.Price, quiz.OwnerId)
 }
 
 func SellQuiz(body *SellQuizRequest, userId uint) error {
@@ -235,7 +246,15 @@ func SellQuiz(body *SellQuizRequest, userId uint) error {
 	}
 
 	if !isQuizOwnedByAccount(acc, quiz) {
-		return errors.New("account already owns the quiz")
+		return errors.New("account does not own the quiz")
+	}
+
+	if quiz.Status != QuizPublished {
+		return ErrQuizNotPublished
+	}
+
+	if quiz.Source.Licensed {
+		return ErrLicensedClone
 	}
 
 	product := Product{
@@ -249,6 +268,7 @@ func SellQuiz(body *SellQuizRequest, userId uint) error {
 		return err
 	}
 
+	reindexQuiz(quiz.Id)
 	return nil
 }
 
@@ -262,6 +282,10 @@ func EditAccount(username string, userId uint, role string, body ModifyAccountRe
 		return errors.New("you dont have permission to modify this account")
 	}
 
+	if body.Language != "" && !languagePattern.MatchString(body.Language) {
+		return errors.New("language must be a code like en or pt-BR")
+	}
+
 	newAcc := Account{
 		Id:          acc.Id,
 		Username:    body.Username,
@@ -273,6 +297,7 @@ func EditAccount(username string, userId uint, role string, body ModifyAccountRe
 		Balance:     acc.Balance,
 		Role:        acc.Role,
 		Quizzes:     acc.Quizzes,
+		Language:    body.Language,
 	}
 
 	err = Db.PutAccount(&newAcc)
@@ -280,6 +305,10 @@ func EditAccount(username string, userId uint, role string, body ModifyAccountRe
 		return err
 	}
 
+	if newAcc.Username != acc.Username {
+		reindexQuizzesOfOwner(acc.Id)
+	}
+
 	return nil
 }
 
@@ -294,13 +323,7 @@ func IsQuizExistingInAccount(acc *Account, quizId uint) bool {
 }
 
 func isQuizOwnedByAccount(acc *Account, quiz *Quiz) bool {
-	for _, val := range acc.Quizzes {
-		if val.Id == quiz.Id && quiz.Owner.Id == acc.Id {
-			return true
-		}
-	}
-
-	return false
+	return quiz.OwnerId == acc.Id
 }
 
 func CreateAccountDto(account *Account) *AccountDto {
@@ -318,5 +341,6 @@ func CreateAccountDto(account *Account) *AccountDto {
 		Description: account.Description,
 		Balance:     account.Balance,
 		Quizzes:     quizzes,
+		Language:    account.Language,
 	}
 }
\ No newline at end of file
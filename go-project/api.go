@@ -3,16 +3,27 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"github.com/rs/cors"
 )
 
 var manager *Manager
+var runner *GameRunner
+
+// shutdownTimeout is how long running games get to finish before they are checkpointed
+const shutdownTimeout = 30 * time.Second
 
 type APIServer struct {
 	listenAddr string
@@ -24,33 +35,124 @@ func NewApiServer(listenAddr string) *APIServer {
 	}
 }
 
-func (s *APIServer) Run() {
+func (s *APIServer) Run() error {
 	manager = NewManager()
+	runner = NewGameRunner()
+	if err := RecoverGames(); err != nil {
+		return err
+	}
+	if err := RebuildSearchIndex(); err != nil {
+		return err
+	}
+
 	router := mux.NewRouter()
 	router.HandleFunc("/api/users/{username}", Auth(handleUser)).Methods("GET", "DELETE", "PUT")
 	router.HandleFunc("/api/users", Auth(handleUser)).Methods("POST")
+	router.HandleFunc("/api/users/{username}/quizzes", Auth(handleUserQuizzes)).Methods("GET")
 	router.HandleFunc("/api/deposit", Auth(handleDeposit)).Methods("POST")
 	router.HandleFunc("/quizzes/sell", Auth(handleSellQuiz)).Methods("POST")
 	router.HandleFunc("/quizzes/buy", Auth(handleBuyQuiz)).Methods("POST")
+	router.HandleFunc("/api/quizzes/search", Auth(handleSearchQuizzes)).Methods("GET")
 	router.HandleFunc("/api/quizzes/{id}", Auth(handleQuizzes)).Methods("GET", "DELETE")
-	router.HandleFunc("/api/quizzes", Auth(handleQuizzes)).Methods("POST", "PUT")
+	router.HandleFunc("/api/quizzes", Auth(handleQuizzes)).Methods("GET", "POST", "PUT")
+	router.HandleFunc("/api/quizzes/import/html", Auth(handleImportHtml)).Methods("POST")
+	router.HandleFunc("/api/quizzes/import/schema", handleQuizSchema).Methods("GET")
+	router.HandleFunc("/api/quizzes/import", Auth(handleImportQuiz)).Methods("POST")
+	router.HandleFunc("/api/quizzes/{id}/export", Auth(handleExportQuiz)).Methods("GET")
+	router.HandleFunc("/api/quizzes/{id}/revisions", Auth(handleQuizRevisions)).Methods("GET")
+	router.HandleFunc("/api/quizzes/{id}/revisions/{number}", Auth(handleQuizRevisions)).Methods("GET")
+	router.HandleFunc("/api/quizzes/{id}/diff", Auth(handleQuizDiff)).Methods("GET")
+	router.HandleFunc("/api/quizzes/{id}/{action:submit|publish|reject|archive|restore}", Auth(handleQuizStatus)).Methods("POST")
+	router.HandleFunc("/api/quizzes/{id}/bank", Auth(handleComposeQuiz)).Methods("POST")
+	router.HandleFunc("/api/quizzes/{id}/clone", Auth(handleCloneQuiz)).Methods("POST")
+	router.HandleFunc("/api/quizzes/{id}/collaborators", Auth(handleQuizCollaborators)).Methods("GET")
+	router.HandleFunc("/api/quizzes/{id}/collaborators/{username}", Auth(handleQuizCollaborators)).Methods("PUT", "DELETE")
+	router.HandleFunc("/api/quizzes/{id}/activity", Auth(handleQuizActivity)).Methods("GET")
+	router.HandleFunc("/api/quizzes/{id}/analytics", Auth(handleQuizAnalytics)).Methods("GET")
+	router.HandleFunc("/api/purchases", Auth(handlePurchases)).Methods("GET")
+	router.HandleFunc("/api/bank", Auth(handleQuestionBank)).Methods("GET", "POST")
+	router.HandleFunc("/api/bank/{id}", Auth(handleQuestionBank)).Methods("GET", "PUT", "DELETE")
+	router.HandleFunc("/api/media", Auth(handleUploadMedia)).Methods("POST")
+	router.HandleFunc("/api/categories", Auth(handleCategories)).Methods("GET", "POST")
+	router.HandleFunc("/api/categories/{id}", Auth(handleCategories)).Methods("PUT", "DELETE")
+	router.HandleFunc("/media/{key}", handleMedia).Methods("GET", "HEAD")
+	router.HandleFunc("/api/purchases/{quizId}/upgrade", Auth(handlePurchases)).Methods("POST")
 	router.HandleFunc("/api/register", handleRegister).Methods("POST")
 	router.HandleFunc("/api/login", handleLogin).Methods("POST")
+	router.HandleFunc("/api/protocol", handleProtocol).Methods("GET")
 	router.HandleFunc("/api/logout", Auth(handleLogout)).Methods("GET")
 	router.HandleFunc("/quiz/comments", Auth(handleComments)).Methods("POST")
 	router.HandleFunc("/quiz/comments/{id}", Auth(handleComments)).Methods("GET", "DELETE", "PATCH")
 	router.HandleFunc("/quiz/ratings", Auth(handleRatings)).Methods("POST")
 	router.HandleFunc("/quiz/ratings/{id}", Auth(handleRatings)).Methods("GET", "DELETE", "PATCH")
+	router.HandleFunc("/api/audits", Auth(handleAudits)).Methods("GET")
+	router.HandleFunc("/api/audits/{id}", Auth(handleAudits)).Methods("PATCH")
 	router.HandleFunc("/game/create", Auth(handleCreateGame)).Methods("POST")
+	router.HandleFunc("/game/random", Auth(handleCreateRandomGame)).Methods("POST")
 	router.HandleFunc("/game/{gameCode}/join", Auth(handleJoinGame)).Methods("POST")
+	router.HandleFunc("/game/{gameCode}/leave", Auth(handleLeaveGame)).Methods("POST")
 	router.HandleFunc("/game/{gameCode}/start", Auth(handleStartGame)).Methods("POST")
+	router.HandleFunc("/game/{gameCode}/ws", Auth(handleGameSocket)).Methods("GET")
+	router.HandleFunc("/game/{gameCode}/events", Auth(handleGameEvents)).Methods("GET")
+	router.HandleFunc("/game/{gameCode}/answer", Auth(handleGameAnswer)).Methods("POST")
+	router.HandleFunc("/game/{gameCode}/bots", Auth(handleAddBots)).Methods("POST")
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:4200"},
 		AllowCredentials: true,
 	})
 
-	handler := c.Handler(router)
-	http.ListenAndServe(s.listenAddr, handler)
+	server := &http.Server{
+		Addr:    s.listenAddr,
+		Handler: c.Handler(router),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go ExpireGameCodesPeriodically(ctx)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	return s.shutdown(server)
+}
+
+// shutdown stops new games, lets running ones finish until shutdownTimeout, closes
+// the websockets and finally the database
+func (s *APIServer) shutdown(server *http.Server) error {
+	log.Println("shutting down")
+	runner.StopAccepting()
+
+	ServerShutdownSend("server is shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// The http server keeps running while games finish, players answering over REST
+	// need it. Closing the clients ends the event streams so it can shut down quickly
+	runner.Shutdown(ctx)
+	manager.CloseAll()
+
+	serverCtx, serverCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer serverCancel()
+
+	if err := server.Shutdown(serverCtx); err != nil {
+		log.Println("http server shutdown: ", err)
+	}
+
+	return Db.Close()
+}
+
+func handleProtocol(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(GetProtocolSchema())
 }
 
 func handleStartGame(w http.ResponseWriter, r *http.Request) {
@@ -64,7 +166,10 @@ func handleStartGame(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		gameCode := vars["gameCode"]
 
-		go StartGame(gameCode, user.UserID)
+		if err := StartGame(gameCode, user.UserID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		return
 	}
@@ -87,14 +192,48 @@ func handleCreateGame(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		code, err := CreateGame(user.UserID, body.QuizId)
+		code, err := CreateGame(user.UserID, user.Role, &body)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		manager.ServeWS(w, r, code)
+		// Websocket clients are connected to the lobby right away, the others get the code
+		// and connect through /game/{gameCode}/ws or the event stream
+		if websocket.IsWebSocketUpgrade(r) {
+			manager.ServeWS(w, r, code)
+			return
+		}
+
+		json.NewEncoder(w).Encode(CreateGameResponse{Code: code})
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleCreateRandomGame(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "POST" {
+		var body CreateRandomGameRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		code, err := CreateRandomGame(user.UserID, &body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
+		json.NewEncoder(w).Encode(CreateGameResponse{Code: code})
 		return
 	}
 
@@ -117,6 +256,32 @@ func handleJoinGame(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if websocket.IsWebSocketUpgrade(r) {
+			manager.ServeWS(w, r, gameCode)
+		}
+
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleGameSocket(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "GET" {
+		vars := mux.Vars(r)
+		gameCode := vars["gameCode"]
+
+		if err := CanConnectToGame(gameCode, user.UserID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
 		manager.ServeWS(w, r, gameCode)
 
 		return
@@ -125,6 +290,113 @@ func handleJoinGame(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
 }
 
+func handleGameEvents(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "GET" {
+		vars := mux.Vars(r)
+		gameCode := vars["gameCode"]
+
+		if err := CanConnectToGame(gameCode, user.UserID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		manager.ServeSSE(w, r, gameCode, user.UserID)
+
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleGameAnswer(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "POST" {
+		vars := mux.Vars(r)
+		gameCode := vars["gameCode"]
+
+		var body Event
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body.Type = EventSendAnswer
+
+		if err := manager.SubmitEvent(gameCode, user.UserID, body); err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(toErrorEvent(body.RequestId, err))
+			return
+		}
+
+		json.NewEncoder(w).Encode(AckEvent{RequestId: body.RequestId})
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleAddBots(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "POST" {
+		vars := mux.Vars(r)
+		gameCode := vars["gameCode"]
+
+		var body AddBotsRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := AddBotsToGame(gameCode, user.UserID, &body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleLeaveGame(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "POST" {
+		vars := mux.Vars(r)
+		gameCode := vars["gameCode"]
+
+		if err := LeaveGame(gameCode, user.UserID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
 func handleSellQuiz(w http.ResponseWriter, r *http.Request) {
 	user, ok := r.Context().Value("user").(UserContext)
 	if !ok {
@@ -177,6 +449,50 @@ func handleBuyQuiz(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
 }
 
+func handlePurchases(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "GET" {
+		page, err := ParsePageRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		purchases, info, err := GetPurchases(user.UserID, page)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		WritePageHeaders(w, r, info)
+		json.NewEncoder(w).Encode(purchases)
+		return
+	} else if r.Method == "POST" {
+		vars := mux.Vars(r)
+		quizId, err := strconv.Atoi(vars["quizId"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		purchase, err := UpgradePurchase(uint(quizId), user.UserID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(purchase)
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
 func handleRatings(w http.ResponseWriter, r *http.Request) {
 	user, ok := r.Context().Value("user").(UserContext)
 	if !ok {
@@ -192,12 +508,19 @@ func handleRatings(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		quizzes, err := GetRatingsForProduct(uint(id))
+		page, err := ParsePageRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		quizzes, info, err := GetRatingsForProduct(uint(id), page)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
+		WritePageHeaders(w, r, info)
 		json.NewEncoder(w).Encode(quizzes)
 		return
 	} else if r.Method == "DELETE" {
@@ -268,12 +591,19 @@ func handleComments(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		quizzes, err := GetCommentsForProduct(uint(id))
+		page, err := ParsePageRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		quizzes, info, err := GetCommentsForProduct(uint(id), page)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
+		WritePageHeaders(w, r, info)
 		json.NewEncoder(w).Encode(quizzes)
 		return
 	} else if r.Method == "DELETE" {
@@ -329,6 +659,50 @@ func handleComments(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
 }
 
+func handleAudits(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "GET" {
+		includeReviewed := r.URL.Query().Get("reviewed") == "true"
+
+		page, err := ParsePageRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		audits, info, err := GetAnswerAudits(user.Role, includeReviewed, page)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		WritePageHeaders(w, r, info)
+		json.NewEncoder(w).Encode(audits)
+		return
+	} else if r.Method == "PATCH" {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := ReviewAnswerAudit(uint(id), user.Role); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
 func handleLogout(w http.ResponseWriter, r *http.Request) {
 	if !DoesUserHaveValidCookie(r) {
 		http.Error(w, "not logged in", http.StatusInternalServerError)
@@ -412,6 +786,19 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
 }
 
+// writeValidationErrors answers with 422 and the broken rules when err is ValidationErrors
+func writeValidationErrors(w http.ResponseWriter, err error) bool {
+	var validationErrs ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(validationErrs)
+	return true
+}
+
 func handleQuizzes(w http.ResponseWriter, r *http.Request) {
 	user, ok := r.Context().Value("user").(UserContext)
 	if !ok {
@@ -427,22 +814,66 @@ func handleQuizzes(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := CreateQuiz(&body, user.UserID); err != nil {
+		if _, err := CreateQuiz(&body, user.UserID); err != nil {
+			if writeValidationErrors(w, err) {
+				return
+			}
+
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
 		return
 	} else if r.Method == "GET" {
-		quizzes, err := GetQuizzesForSale()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		vars := mux.Vars(r)
+		if vars["id"] != "" {
+			id, err := strconv.Atoi(vars["id"])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			quiz, err := GetQuiz(uint(id), user.UserID, user.Role)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(quiz)
 			return
 		}
 
-		json.NewEncoder(w).Encode(quizzes)
-		return
-	} else if r.Method == "DELETE" {
+		query := r.URL.Query()
+		filter := ProductFilter{
+			Tags:       query["tag"],
+			Difficulty: query.Get("difficulty"),
+			Language:   query.Get("language"),
+		}
+		if value := query.Get("category"); value != "" {
+			categoryId, err := strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			filter.CategoryId = uint(categoryId)
+		}
+
+		page, err := ParsePageRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		quizzes, info, err := GetQuizzesForSale(&filter, page)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		WritePageHeaders(w, r, info)
+		json.NewEncoder(w).Encode(quizzes)
+		return
+	} else if r.Method == "DELETE" {
 		if user.Role != Admin {
 			http.Error(w, "Missing permission", http.StatusForbidden)
 			return
@@ -455,29 +886,803 @@ func handleQuizzes(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := DeleteQuiz(id); err != nil {
+		if err := DeleteQuiz(id); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		return
+	} else if r.Method == "PUT" {
+		var body ModifyQuizRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := ModifyQuiz(&body, user.UserID, user.Role); err != nil {
+			if writeValidationErrors(w, err) {
+				return
+			}
+
+			if errors.Is(err, ErrQuizConflict) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleImportHtml(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "POST" {
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		file, _, err := r.FormFile("document")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		rules, err := ParseHtmlImportRules([]byte(r.FormValue("rules")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		preview := r.FormValue("preview") != "false"
+		result, err := ImportHtmlQuiz(file, rules, user.UserID, preview)
+		if err != nil {
+			if writeValidationErrors(w, err) {
+				return
+			}
+
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleQuizSchema(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(GetQuizDataSchema())
+}
+
+func handleImportQuiz(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "POST" {
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		file, _, err := r.FormFile("document")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		preview := r.FormValue("preview") != "false"
+		result, err := ImportQuiz(r.FormValue("format"), file, r.FormValue("name"), user.UserID, preview)
+		if err != nil {
+			if writeValidationErrors(w, err) {
+				return
+			}
+
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleExportQuiz(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "GET" {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = FormatJSON
+		}
+
+		data, contentType, err := ExportQuiz(uint(id), user.UserID, user.Role, format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"quiz-%d.%s\"", id, FormatExtension(format)))
+		w.Write(data)
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleQuizRevisions(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "GET" {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if vars["number"] == "" {
+			page, err := ParsePageRequest(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			revisions, info, err := GetQuizRevisions(uint(id), user.UserID, user.Role, page)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			WritePageHeaders(w, r, info)
+			json.NewEncoder(w).Encode(revisions)
+			return
+		}
+
+		number, err := strconv.Atoi(vars["number"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		revision, err := GetQuizRevision(uint(id), uint(number), user.UserID, user.Role)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(revision)
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleCategories(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "GET" {
+		categories, err := GetCategoryTree()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(categories)
+		return
+	}
+
+	if user.Role != Admin {
+		http.Error(w, "Missing permission", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == "POST" {
+		var body CategoryRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		category, err := CreateCategory(&body, user.Role)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(category)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == "PUT" {
+		var body CategoryRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		category, err := ModifyCategory(uint(id), &body, user.Role)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(category)
+		return
+	} else if r.Method == "DELETE" {
+		if err := DeleteCategory(uint(id), user.Role); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleUploadMedia(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "POST" {
+		r.Body = http.MaxBytesReader(w, r.Body, maxMediaSize+1<<20)
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		media, err := UploadMedia(file, user.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrMediaType):
+				http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			case errors.Is(err, ErrMediaTooLarge):
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			default:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(media)
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+// handleMedia serves uploaded media, the content behind a key never changes so clients
+// may cache it for good
+func handleMedia(w http.ResponseWriter, r *http.Request) {
+	media, content, err := OpenMedia(mux.Vars(r)["key"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", media.ContentType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(mediaCacheAge.Seconds())))
+	w.Header().Set("ETag", `"`+media.Key+`"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", media.CreatedAt, content)
+}
+
+func handleSearchQuizzes(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		values := r.URL.Query()
+		query := SearchQuery{
+			Text:       values.Get("q"),
+			Difficulty: values.Get("difficulty"),
+			Language:   values.Get("language"),
+		}
+
+		parseFloat := func(name string) (*float32, error) {
+			value := values.Get(name)
+			if value == "" {
+				return nil, nil
+			}
+			number, err := strconv.ParseFloat(value, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a number", name)
+			}
+			result := float32(number)
+			return &result, nil
+		}
+
+		var err error
+		if query.MinPrice, err = parseFloat("minPrice"); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if query.MaxPrice, err = parseFloat("maxPrice"); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		minRating, err := parseFloat("minRating")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if minRating != nil {
+			query.MinRating = float64(*minRating)
+		}
+
+		var categoryId int
+		if value := values.Get("category"); value != "" {
+			if categoryId, err = strconv.Atoi(value); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		page, err := ParsePageRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		hits, info, err := SearchQuizzes(&query, uint(categoryId), page)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		WritePageHeaders(w, r, info)
+		json.NewEncoder(w).Encode(hits)
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleQuizStatus(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "POST" {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		quiz, err := ChangeQuizStatus(uint(id), vars["action"], user.UserID, user.Role)
+		if err != nil {
+			if writeValidationErrors(w, err) {
+				return
+			}
+
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(quiz)
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleCloneQuiz(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "POST" {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var revision int
+		if value := r.URL.Query().Get("revision"); value != "" {
+			if revision, err = strconv.Atoi(value); err != nil || revision < 0 {
+				http.Error(w, "revision must be a positive number", http.StatusBadRequest)
+				return
+			}
+		}
+
+		quiz, err := CloneQuiz(uint(id), user.UserID, user.Role, uint(revision))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(quiz)
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleQuizCollaborators(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == "GET" {
+		collaborators, err := GetQuizCollaborators(uint(id), user.UserID, user.Role)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
+		json.NewEncoder(w).Encode(collaborators)
 		return
 	} else if r.Method == "PUT" {
-		var body ModifyQuizRequest
-		userId, ok := r.Context().Value("userID").(uint)
-		if !ok {
-			http.Error(w, "userID not found in context", http.StatusInternalServerError)
+		var body CollaboratorRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		collaborator, err := SetQuizCollaborator(uint(id), vars["username"], &body, user.UserID, user.Role)
+		if err != nil {
+			if errors.Is(err, ErrNotQuizOwner) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(collaborator)
+		return
+	} else if r.Method == "DELETE" {
+		if err := RemoveQuizCollaborator(uint(id), vars["username"], user.UserID, user.Role); err != nil {
+			if errors.Is(err, ErrNotQuizOwner) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleQuizActivity(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "GET" {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page, err := ParsePageRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		activities, info, err := GetQuizActivity(uint(id), user.UserID, user.Role, page)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		WritePageHeaders(w, r, info)
+		json.NewEncoder(w).Encode(activities)
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleQuizAnalytics(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "GET" {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var revision int
+		if value := r.URL.Query().Get("revision"); value != "" {
+			if revision, err = strconv.Atoi(value); err != nil || revision < 0 {
+				http.Error(w, "revision must be a positive number", http.StatusBadRequest)
+				return
+			}
+		}
+
+		switch r.URL.Query().Get("format") {
+		case "", FormatJSON:
+			analysis, err := GetQuizAnalysis(uint(id), user.UserID, user.Role, uint(revision))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			json.NewEncoder(w).Encode(analysis)
+		case FormatCSV:
+			data, err := ExportQuizAnalysis(uint(id), user.UserID, user.Role, uint(revision))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"quiz-%d-analytics.csv\"", id))
+			w.Write(data)
+		default:
+			http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		}
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleComposeQuiz(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "POST" {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var body ComposeQuizRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := AddBankQuestionsToQuiz(uint(id), &body, user.UserID, user.Role); err != nil {
+			if writeValidationErrors(w, err) {
+				return
+			}
+
+			if errors.Is(err, ErrQuizConflict) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleQuestionBank(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	if r.Method == "GET" && vars["id"] == "" {
+		page, err := ParsePageRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := BankFilter{
+			Tags:       query["tag"],
+			Difficulty: query.Get("difficulty"),
+		}
+
+		questions, info, err := GetBankQuestions(user.UserID, &filter, page)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		WritePageHeaders(w, r, info)
+		json.NewEncoder(w).Encode(questions)
+		return
+	} else if r.Method == "POST" {
+		var body BankQuestionRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		question, err := CreateBankQuestion(&body, user.UserID)
+		if err != nil {
+			if writeValidationErrors(w, err) {
+				return
+			}
+
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(question)
+		return
+	}
+
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == "GET" {
+		question, err := GetBankQuestion(uint(id), user.UserID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
+		json.NewEncoder(w).Encode(question)
+		return
+	} else if r.Method == "PUT" {
+		var body BankQuestionRequest
+
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if err := ModifyQuiz(&body, userId, user.Role); err != nil {
+
+		question, err := ModifyBankQuestion(uint(id), &body, user.UserID)
+		if err != nil {
+			if writeValidationErrors(w, err) {
+				return
+			}
+
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(question)
+		return
+	} else if r.Method == "DELETE" {
+		if err := DeleteBankQuestion(uint(id), user.UserID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
+func handleQuizDiff(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "GET" {
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Both ends are optional, by default the latest revision is compared to the one before
+		var from, to int
+		if value := r.URL.Query().Get("from"); value != "" {
+			if from, err = strconv.Atoi(value); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if value := r.URL.Query().Get("to"); value != "" {
+			if to, err = strconv.Atoi(value); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		diff, err := DiffQuizRevisions(uint(id), uint(from), uint(to), user.UserID, user.Role)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
+		json.NewEncoder(w).Encode(diff)
 		return
 	}
 
@@ -510,6 +1715,34 @@ func handleDeposit(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
 }
 
+func handleUserQuizzes(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == "GET" {
+		page, err := ParsePageRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		quizzes, info, err := GetQuizzesOfOwner(mux.Vars(r)["username"], user.UserID, user.Role, page)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		WritePageHeaders(w, r, info)
+		json.NewEncoder(w).Encode(quizzes)
+		return
+	}
+
+	http.Error(w, "The payload is in an unsupported format", http.StatusUnsupportedMediaType)
+}
+
 func handleUser(w http.ResponseWriter, r *http.Request) {
 	user, ok := r.Context().Value("user").(UserContext)
 	if !ok {
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"log"
+)
+
+// LogSuspiciousAnswer stores a rejected or suspicious answer submission for review
+func LogSuspiciousAnswer(audit *AnswerAudit) {
+	log.Printf("suspicious answer by player %d in game %d: %s", audit.PlayerId, audit.GameId, audit.Reason)
+
+	if err := Db.PostAnswerAudit(audit); err != nil {
+		log.Println("failed to store answer audit: ", err)
+	}
+}
+
+func GetAnswerAudits(role string, includeReviewed bool, page *PageRequest) ([]AnswerAuditDto, *PageInfo, error) {
+	if role != Admin {
+		return nil, nil, errors.New("you do not have permission to review answers")
+	}
+
+	audits, info, err := Db.GetAnswerAudits(includeReviewed, page)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	auditsDto := make([]AnswerAuditDto, 0, len(audits))
+	for _, audit := range audits {
+		auditsDto = append(auditsDto, *CreateAnswerAuditDto(&audit))
+	}
+
+	return auditsDto, info, nil
+}
+
+func ReviewAnswerAudit(id uint, role string) error {
+	if role != Admin {
+		return errors.New("you do not have permission to review answers")
+	}
+
+	audit, err := Db.GetAnswerAuditById(id)
+	if err != nil {
+		return err
+	}
+
+	audit.IsReviewed = true
+
+	return Db.PutAnswerAudit(audit)
+}
+
+func CreateAnswerAuditDto(audit *AnswerAudit) *AnswerAuditDto {
+	return &AnswerAuditDto{
+		Id:             audit.Id,
+		GameId:         audit.GameId,
+		PlayerName:     audit.Player.Username,
+		QuestionId:     audit.QuestionId,
+		AnswerId:       audit.AnswerId,
+		ResponseTimeMs: audit.ResponseTimeMs,
+		Reason:         audit.Reason,
+		IsReviewed:     audit.IsReviewed,
+		CreatedAt:      audit.CreatedAt,
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	BotEasy   = "easy"
+	BotMedium = "medium"
+	BotHard   = "hard"
+
+	// maxBotsPerRequest keeps a single request from flooding a lobby
+	maxBotsPerRequest = 200
+	// minBotResponseTime is the fastest a bot will ever answer
+	minBotResponseTime = 200 * time.Millisecond
+)
+
+// BotDifficulty describes how well and how fast a bot answers
+type BotDifficulty struct {
+	// Accuracy is the probability of picking a right answer
+	Accuracy float64 `json:"accuracy"`
+	// ResponseTimeMs is the mean time a bot takes to answer
+	ResponseTimeMs uint `json:"responseTimeMs"`
+	// ResponseJitterMs is the standard deviation of the response time
+	ResponseJitterMs uint `json:"responseJitterMs"`
+}
+
+var botDifficulties = map[string]BotDifficulty{
+	BotEasy:   {Accuracy: 0.4, ResponseTimeMs: 6000, ResponseJitterMs: 2000},
+	BotMedium: {Accuracy: 0.65, ResponseTimeMs: 4000, ResponseJitterMs: 1500},
+	BotHard:   {Accuracy: 0.9, ResponseTimeMs: 2000, ResponseJitterMs: 750},
+}
+
+// Bot is a server side participant. It is connected to the manager like any other
+// client and answers through the same event handlers as human players
+type Bot struct {
+	client     *Client
+	difficulty BotDifficulty
+	random     *rand.Rand
+}
+
+func NewBot(userId uint, gameCode string, difficulty BotDifficulty) *Bot {
+	return &Bot{
+		client:     NewClient(nil, userId, gameCode),
+		difficulty: difficulty,
+		random:     rand.New(rand.NewSource(time.Now().UnixNano() + int64(userId))),
+	}
+}
+
+// AddBotsToGame creates bot players and joins them to the lobby of the game
+func AddBotsToGame(gameCode string, userId uint, body *AddBotsRequest) error {
+	if body.Count == 0 || body.Count > maxBotsPerRequest {
+		return fmt.Errorf("bot count must be between 1 and %d", maxBotsPerRequest)
+	}
+
+	difficulty, err := resolveBotDifficulty(body)
+	if err != nil {
+		return err
+	}
+
+	game, err := Db.GetGameByCode(gameCode)
+	if err != nil {
+		return err
+	} else if game.CreatorId != userId {
+		return errors.New("cannot add bots to a game you are not the creator of")
+	} else if game.IsInProgress {
+		return errors.New("cannot add bots to a game in progress")
+	}
+
+	accounts, err := getBotAccounts(body.Count)
+	if err != nil {
+		return err
+	}
+
+	joined := make([]uint, 0, len(accounts))
+	for _, acc := range accounts {
+		if err := JoinGame(gameCode, acc.Id); err != nil {
+			removeBotsFromGame(gameCode, joined)
+			return err
+		}
+
+		bot := NewBot(acc.Id, gameCode, difficulty)
+		manager.addClient(bot.client)
+		go bot.run()
+		joined = append(joined, acc.Id)
+	}
+
+	return nil
+}
+
+// removeBotsFromGame takes the bots of a request that failed halfway back out of the lobby
+func removeBotsFromGame(gameCode string, botIds []uint) {
+	for _, botId := range botIds {
+		if err := LeaveGame(gameCode, botId); err != nil {
+			log.Printf("failed to remove bot %d from game %s: %v", botId, gameCode, err)
+		}
+	}
+}
+
+func resolveBotDifficulty(body *AddBotsRequest) (BotDifficulty, error) {
+	if body.Custom != nil {
+		if body.Custom.Accuracy < 0 || body.Custom.Accuracy > 1 {
+			return BotDifficulty{}, errors.New("bot accuracy must be between 0 and 1")
+		}
+		return *body.Custom, nil
+	}
+
+	if body.Difficulty == "" {
+		return botDifficulties[BotMedium], nil
+	}
+
+	difficulty, ok := botDifficulties[body.Difficulty]
+	if !ok {
+		return BotDifficulty{}, fmt.Errorf("unknown bot difficulty %q", body.Difficulty)
+	}
+
+	return difficulty, nil
+}
+
+// getBotAccounts returns count bot accounts that are not in a game, creating missing ones
+func getBotAccounts(count uint) ([]Account, error) {
+	accounts, err := Db.GetIdleBotAccounts(int(count))
+	if err != nil {
+		return nil, err
+	}
+
+	for uint(len(accounts)) < count {
+		acc, err := createBotAccount()
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, *acc)
+	}
+
+	return accounts, nil
+}
+
+func createBotAccount() (*Account, error) {
+	suffix, err := GenerateGameCode(false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bots never log in, the password only has to be impossible to guess
+	secret, err := GenerateGameCode(false)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret+suffix), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	username := "bot" + suffix
+	account := Account{
+		Username:  username,
+		Password:  string(hash),
+		FirstName: "Bot",
+		Email:     username + "@bots.quizzland",
+		Role:      Buser,
+	}
+
+	if err := Db.PostAccount(&account); err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+// run consumes the events sent to the bot until the game is over
+func (b *Bot) run() {
+	defer manager.removeClient(b.client)
+
+	for message := range b.client.egress {
+		switch message.Type {
+		case EventNextRound:
+			event, err := message.Event()
+			if err != nil {
+				log.Printf("bot %d: %v", b.client.userId, err)
+				continue
+			}
+
+			var round NextRoundEvent
+			if err := json.Unmarshal(event.Payload, &round); err != nil {
+				log.Printf("bot %d: bad next round payload: %v", b.client.userId, err)
+				continue
+			}
+			b.answer(round.Question)
+		case EventGameOver, EventServerShutdown:
+			return
+		}
+	}
+}
+
+func (b *Bot) answer(question QuestionDto) {
+	answers, err := Db.GetAnswersByQuestionId(int(question.Id))
+	if err != nil || len(answers) == 0 {
+		return
+	}
+
+	time.Sleep(b.responseTime())
+
+	answerId := b.pickAnswer(answers)
+	payload, err := json.Marshal(SendAnswerEvent{
+		AnswerId:   answerId,
+		QuestionId: strconv.FormatUint(uint64(question.Id), 10),
+	})
+	if err != nil {
+		return
+	}
+
+	if err := manager.routeEvent(Event{Type: EventSendAnswer, Payload: payload}, b.client); err != nil {
+		log.Printf("bot %d: %v", b.client.userId, err)
+	}
+}
+
+func (b *Bot) pickAnswer(answers []Answer) uint {
+	var right, wrong []Answer
+	for _, answer := range answers {
+		if answer.IsRight {
+			right = append(right, answer)
+		} else {
+			wrong = append(wrong, answer)
+		}
+	}
+
+	pool := wrong
+	if len(right) > 0 && (len(wrong) == 0 || b.random.Float64() < b.difficulty.Accuracy) {
+		pool = right
+	}
+
+	return pool[b.random.Intn(len(pool))].Id
+}
+
+func (b *Bot) responseTime() time.Duration {
+	mean := float64(b.difficulty.ResponseTimeMs)
+	jitter := float64(b.difficulty.ResponseJitterMs)
+
+	d := time.Duration(mean+b.random.NormFloat64()*jitter) * time.Millisecond
+	if d < minBotResponseTime {
+		d = minBotResponseTime
+	}
+
+	return d
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Difficulties a quiz can declare
+const (
+	DifficultyEasy   = "easy"
+	DifficultyMedium = "medium"
+	DifficultyHard   = "hard"
+)
+
+const (
+	maxCategoryNameLength = 32
+	maxTagLength          = 32
+	maxTagsPerQuiz        = 10
+)
+
+// languagePattern accepts language tags like en, bg or pt-BR
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+var (
+	ErrCategoryInUse    = errors.New("category still has subcategories or quizzes")
+	ErrCategoryCycle    = errors.New("category cannot be moved below itself")
+	ErrMissingAdminRole = errors.New("only admins can manage categories")
+)
+
+// GetCategoryTree returns the root categories with their subcategories
+func GetCategoryTree() ([]CategoryDto, error) {
+	categories, err := Db.GetCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint][]Category)
+	var roots []Category
+	for _, category := range categories {
+		if category.ParentId == nil {
+			roots = append(roots, category)
+		} else {
+			children[*category.ParentId] = append(children[*category.ParentId], category)
+		}
+	}
+
+	var build func(categories []Category) []CategoryDto
+	build = func(categories []Category) []CategoryDto {
+		dtos := make([]CategoryDto, 0, len(categories))
+		for _, category := range categories {
+			dtos = append(dtos, CategoryDto{
+				Id:       category.Id,
+				Name:     category.Name,
+				ParentId: category.ParentId,
+				Children: build(children[category.Id]),
+			})
+		}
+		return dtos
+	}
+
+	return build(roots), nil
+}
+
+func CreateCategory(body *CategoryRequest, role string) (*Category, error) {
+	if role != Admin {
+		return nil, ErrMissingAdminRole
+	}
+
+	category := Category{Name: strings.TrimSpace(body.Name), ParentId: body.ParentId}
+	if err := validateCategory(&category); err != nil {
+		return nil, err
+	}
+
+	if err := Db.PostCategory(&category); err != nil {
+		return nil, err
+	}
+
+	return &category, nil
+}
+
+// ModifyCategory renames the category or moves it below another parent
+func ModifyCategory(id uint, body *CategoryRequest, role string) (*Category, error) {
+	if role != Admin {
+		return nil, ErrMissingAdminRole
+	}
+
+	category, err := Db.GetCategoryById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	category.Name = strings.TrimSpace(body.Name)
+	category.ParentId = body.ParentId
+	if err := validateCategory(category); err != nil {
+		return nil, err
+	}
+
+	if err := Db.PutCategory(category); err != nil {
+		return nil, err
+	}
+
+	return category, nil
+}
+
+func DeleteCategory(id uint, role string) error {
+	if role != Admin {
+		return ErrMissingAdminRole
+	}
+
+	inUse, err := Db.IsCategoryInUse(id)
+	if err != nil {
+		return err
+	} else if inUse {
+		return ErrCategoryInUse
+	}
+
+	return Db.DeleteCategoryById(id)
+}
+
+// validateCategory checks the name and that the parent exists and is not the category
+// itself or one of its subcategories
+func validateCategory(category *Category) error {
+	if category.Name == "" || utf8.RuneCountInString(category.Name) > maxCategoryNameLength {
+		return fmt.Errorf("category name must have between 1 and %d characters", maxCategoryNameLength)
+	}
+
+	if category.ParentId == nil {
+		return nil
+	}
+
+	categories, err := Db.GetCategories()
+	if err != nil {
+		return err
+	}
+
+	parents := make(map[uint]*uint, len(categories))
+	for _, c := range categories {
+		parents[c.Id] = c.ParentId
+	}
+
+	if _, ok := parents[*category.ParentId]; !ok {
+		return errors.New("parent category does not exist")
+	}
+
+	for id := category.ParentId; id != nil; id = parents[*id] {
+		if *id == category.Id {
+			return ErrCategoryCycle
+		}
+	}
+
+	return nil
+}
+
+// categoryWithDescendants returns the id of the category and of every category below it
+func categoryWithDescendants(id uint) ([]uint, error) {
+	categories, err := Db.GetCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint][]uint)
+	for _, category := range categories {
+		if category.ParentId != nil {
+			children[*category.ParentId] = append(children[*category.ParentId], category.Id)
+		}
+	}
+
+	ids := []uint{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+
+	return ids, nil
+}
+
+// validateQuizMetadata checks the metadata a quiz is created or modified with
+func validateQuizMetadata(metadata *QuizMetadata) ValidationErrors {
+	var errs ValidationErrors
+
+	switch metadata.Difficulty {
+	case "", DifficultyEasy, DifficultyMedium, DifficultyHard:
+	default:
+		errs = append(errs, ValidationError{Field: "difficulty", Message: "difficulty must be empty, easy, medium or hard"})
+	}
+
+	if metadata.Language != "" && !languagePattern.MatchString(metadata.Language) {
+		errs = append(errs, ValidationError{Field: "language", Message: "language must be a code like en or pt-BR"})
+	}
+
+	if metadata.CategoryId != nil {
+		if _, err := Db.GetCategoryById(*metadata.CategoryId); err != nil {
+			errs = append(errs, ValidationError{Field: "categoryId", Message: "category does not exist"})
+		}
+	}
+
+	for i, tag := range metadata.Tags {
+		name := normalizeTag(tag)
+		if name == "" {
+			errs = append(errs, ValidationError{Field: fmt.Sprintf("tags[%d]", i), Message: "tag is empty"})
+		} else if utf8.RuneCountInString(name) > maxTagLength {
+			errs = append(errs, ValidationError{Field: fmt.Sprintf("tags[%d]", i), Message: fmt.Sprintf("tag is longer than %d characters", maxTagLength)})
+		}
+	}
+	if len(normalizeTags(metadata.Tags)) > maxTagsPerQuiz {
+		errs = append(errs, ValidationError{Field: "tags", Message: fmt.Sprintf("a quiz can have at most %d tags", maxTagsPerQuiz)})
+	}
+
+	return errs
+}
+
+// applyQuizMetadata sets validated metadata on the quiz, tags that do not exist yet are
+// created
+func applyQuizMetadata(quiz *Quiz, metadata *QuizMetadata) error {
+	tags, err := Db.GetOrCreateTags(normalizeTags(metadata.Tags))
+	if err != nil {
+		return err
+	}
+
+	quiz.CategoryId = metadata.CategoryId
+	quiz.Category = nil
+	quiz.Tags = tags
+	quiz.Difficulty = metadata.Difficulty
+	quiz.Language = metadata.Language
+	return nil
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// normalizeTags returns the tags lower case without duplicates and empty ones
+func normalizeTags(tags []string) []string {
+	names := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		name := normalizeTag(tag)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func tagNames(tags []Tag) []string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+
+	return names
+}
+
+func categoryName(category *Category) string {
+	if category == nil {
+		return ""
+	}
+
+	return category.Name
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"log"
 	"time"
 
@@ -12,9 +11,13 @@ type ClientList map[*Client]bool
 
 type Client struct {
 	connection *websocket.Conn
-	egress     chan Event
+	egress     chan *OutgoingMessage
 	userId     uint
 	gameCode   string
+	// protocolVersion is the version agreed on in the hello handshake
+	protocolVersion int
+	// encoding is the message encoding negotiated when the websocket was opened
+	encoding string
 }
 
 var (
@@ -24,15 +27,31 @@ var (
 	// Because that can make decimals, so instead *9 / 10 to get 90%
 	// The reason why it has to be less than PingRequency is becuase otherwise it will send a new Ping before getting response
 	pingInterval = (pongWait * 9) / 10
+	// egressBuffer is how many events may queue up for a client before it is treated as a slow consumer
+	egressBuffer = 16
 )
 
 // NewClient is used to initialize a new Client with all required values initialized
 func NewClient(conn *websocket.Conn, userID uint, gameCode string) *Client {
 	return &Client{
 		connection: conn,
-		egress:     make(chan Event),
+		egress:     make(chan *OutgoingMessage, egressBuffer),
 		userId:     userID,
 		gameCode:   gameCode,
+		// Clients that skip the handshake get the current version
+		protocolVersion: ProtocolVersion,
+		encoding:        EncodingJSON,
+	}
+}
+
+// trySend queues the event without blocking, it reports false when the egress is full.
+// Callers must hold the manager lock so the egress cannot be closed underneath them
+func (c *Client) trySend(message *OutgoingMessage) bool {
+	select {
+	case c.egress <- message:
+		return true
+	default:
+		return false
 	}
 }
 
@@ -60,14 +79,19 @@ func (c *Client) readMessages() {
 			break
 		}
 
-		var request Event
-		if err := json.Unmarshal(payload, &request); err != nil {
+		request, err := decodeEvent(c.encoding, payload)
+		if err != nil {
 			log.Printf("error marshalling message: %v", err)
+			replySend(c, "", NewProtocolError(ErrorCodeBadRequest, "message is not a valid event"))
+			continue
 		}
 
-		if err := manager.routeEvent(request, c); err != nil {
+		err = manager.routeEvent(request, c)
+		if err != nil {
 			log.Println("Error handeling Message: ", err)
 		}
+
+		replySend(c, request.RequestId, err)
 	}
 }
 
@@ -100,13 +124,13 @@ func (c *Client) writeMessages() {
 				return
 			}
 
-			data, err := json.Marshal(message)
+			// The frame is shared by every client of the game using the same encoding
+			prepared, err := message.Prepared(c.encoding)
 			if err != nil {
 				log.Println(err)
 				return // closes the connection, should we really
 			}
-			// Write a Regular text message to the connection
-			if err := c.connection.WriteMessage(websocket.TextMessage, data); err != nil {
+			if err := c.connection.WritePreparedMessage(prepared); err != nil {
 				log.Println(err)
 			}
 			log.Println("sent message")
@@ -22,13 +22,13 @@ func DeleteComment(id uint, userId uint, role string) error {
 	return nil
 }
 
-func GetCommentsForProduct(productId uint) ([]Comment, error) {
-	comments, err := Db.GetCommentsByProductId(productId)
+func GetCommentsForProduct(productId uint, page *PageRequest) ([]Comment, *PageInfo, error) {
+	comments, info, err := Db.GetCommentsByProductId(productId, page)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return comments, nil
+	return comments, info, nil
 }
 
 func CreateComment(body *CreateCommentRequest, userId uint) error {
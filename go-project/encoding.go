@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Encodings a websocket client can negotiate through the Sec-WebSocket-Protocol header.
+// Clients that do not ask for one get JSON
+const (
+	EncodingJSON    = "quizzland.json"
+	EncodingMsgpack = "quizzland.msgpack"
+)
+
+var SupportedEncodings = []string{EncodingJSON, EncodingMsgpack}
+
+// OutgoingMessage is an event on its way to one or more clients. It is encoded at most
+// once per encoding no matter how many clients it is sent to
+type OutgoingMessage struct {
+	Type      string
+	RequestId string
+	payload   interface{}
+
+	jsonOnce sync.Once
+	jsonData []byte
+	jsonErr  error
+
+	msgpackOnce sync.Once
+	msgpackData []byte
+	msgpackErr  error
+
+	preparedLock sync.Mutex
+	prepared     map[string]*websocket.PreparedMessage
+}
+
+func NewOutgoingMessage(eventType string, payload interface{}) *OutgoingMessage {
+	return &OutgoingMessage{Type: eventType, payload: payload}
+}
+
+// Encode returns the message in the given encoding
+func (m *OutgoingMessage) Encode(encoding string) ([]byte, error) {
+	if encoding == EncodingMsgpack {
+		m.msgpackOnce.Do(func() {
+			m.msgpackData, m.msgpackErr = marshalMsgpack(msgpackEvent{
+				Type:      m.Type,
+				Payload:   m.payload,
+				RequestId: m.RequestId,
+			})
+		})
+		return m.msgpackData, m.msgpackErr
+	}
+
+	m.jsonOnce.Do(func() {
+		var payload []byte
+		payload, m.jsonErr = json.Marshal(m.payload)
+		if m.jsonErr != nil {
+			return
+		}
+		m.jsonData, m.jsonErr = json.Marshal(Event{Type: m.Type, Payload: payload, RequestId: m.RequestId})
+	})
+	return m.jsonData, m.jsonErr
+}
+
+// Prepared returns the message as a websocket frame that can be written to any number
+// of connections using the encoding
+func (m *OutgoingMessage) Prepared(encoding string) (*websocket.PreparedMessage, error) {
+	m.preparedLock.Lock()
+	defer m.preparedLock.Unlock()
+
+	if prepared, ok := m.prepared[encoding]; ok {
+		return prepared, nil
+	}
+
+	data, err := m.Encode(encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	messageType := websocket.TextMessage
+	if encoding == EncodingMsgpack {
+		messageType = websocket.BinaryMessage
+	}
+
+	prepared, err := websocket.NewPreparedMessage(messageType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.prepared == nil {
+		m.prepared = make(map[string]*websocket.PreparedMessage)
+	}
+	m.prepared[encoding] = prepared
+
+	return prepared, nil
+}
+
+// Event returns the message as it would be received by a JSON client
+func (m *OutgoingMessage) Event() (Event, error) {
+	data, err := m.Encode(EncodingJSON)
+	if err != nil {
+		return Event{}, err
+	}
+
+	var event Event
+	err = json.Unmarshal(data, &event)
+	return event, err
+}
+
+// msgpackEvent is the msgpack form of Event, the payload is embedded as a value instead
+// of nested JSON
+type msgpackEvent struct {
+	Type      string      `json:"type"`
+	Payload   interface{} `json:"payload"`
+	RequestId string      `json:"requestId,omitempty"`
+}
+
+// marshalMsgpack encodes v using the json tags so both encodings share field names
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.SetCustomStructTag("json")
+	encoder.UseCompactInts(true)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeEvent reads an event sent by a client in the given encoding. Msgpack payloads are
+// converted to JSON so the event handlers do not have to care about the encoding
+func decodeEvent(encoding string, data []byte) (Event, error) {
+	var event Event
+
+	if encoding != EncodingMsgpack {
+		err := json.Unmarshal(data, &event)
+		return event, err
+	}
+
+	var incoming msgpackEvent
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+	if err := decoder.Decode(&incoming); err != nil {
+		return event, err
+	}
+
+	payload, err := json.Marshal(incoming.Payload)
+	if err != nil {
+		return event, fmt.Errorf("payload cannot be converted to JSON: %v", err)
+	}
+
+	event.Type = incoming.Type
+	event.Payload = payload
+	event.RequestId = incoming.RequestId
+	return event, nil
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"time"
 )
 
 // EventHandler is a function signature that is used to affect messages on the socket and triggered
@@ -14,6 +16,11 @@ const (
 	EventSendAnswer = "send_answer"
 	EventNextRound  = "next_round"
 	EventStartTimer = "start_timer"
+	EventServerShutdown = "server_shutdown"
+	EventGameOver = "game_over"
+	EventHello = "hello"
+	EventAck = "ack"
+	EventError = "error"
 )
 
 // SendMessageHandler will send out a message to all other participants in the chat
@@ -21,40 +28,81 @@ func SendAnswerHandler(event Event, c *Client) error {
 	// Marshal Payload into wanted format
 	var sendAnswerEvent SendAnswerEvent
 	if err := json.Unmarshal(event.Payload, &sendAnswerEvent); err != nil {
-		return fmt.Errorf("bad payload in request: %v", err)
+		return NewProtocolError(ErrorCodeBadRequest, fmt.Sprintf("bad payload in request: %v", err))
 	}
 
-	answer, err := Db.GetAnswerById(sendAnswerEvent.AnswerId)
+	questionId, err := strconv.ParseUint(sendAnswerEvent.QuestionId, 10, 64)
 	if err != nil {
-		return nil
-	} else if answer.IsRight {
-		AddPointsToPlayer(c.userId, c.gameCode, answer.Points)
+		return NewProtocolError(ErrorCodeBadRequest, "question id must be a number")
 	}
 
-	return nil
+	return runner.SubmitAnswer(c.gameCode, c.userId, uint(questionId), sendAnswerEvent.AnswerId)
 }
 
-func NextRoundSend(question QuestionDto, stats []StatDto, gameCode string) error {
+// HelloHandler checks that the client speaks a protocol version this server supports
+func HelloHandler(event Event, c *Client) error {
+	var hello HelloEvent
+	if err := json.Unmarshal(event.Payload, &hello); err != nil {
+		return NewProtocolError(ErrorCodeBadRequest, fmt.Sprintf("bad payload in request: %v", err))
+	}
+
+	for _, version := range SupportedProtocolVersions {
+		if version == hello.ProtocolVersion {
+			c.protocolVersion = version
+			return nil
+		}
+	}
+
+	return NewProtocolError(ErrorCodeUnsupportedVersion, fmt.Sprintf("protocol version %d is not supported", hello.ProtocolVersion))
+}
+
+// HelloSend announces the protocol version and the negotiated encoding to a newly
+// connected client
+func HelloSend(c *Client) {
+	manager.SendToClient(c, NewOutgoingMessage(EventHello, HelloEvent{
+		ProtocolVersion:   ProtocolVersion,
+		SupportedVersions: SupportedProtocolVersions,
+		Encoding:          c.encoding,
+	}))
+}
+
+// replySend acknowledges a client event, or reports why it was rejected when err is set
+func replySend(c *Client, requestId string, err error) {
+	message := NewOutgoingMessage(EventAck, AckEvent{RequestId: requestId})
+	if err != nil {
+		message = NewOutgoingMessage(EventError, toErrorEvent(requestId, err))
+	}
+	message.RequestId = requestId
+
+	manager.SendToClient(c, message)
+}
+
+// NextRoundSend broadcasts the next question, the message is encoded once for the whole game
+func NextRoundSend(question QuestionDto, stats []StatDto, gameCode string) {
+	// Broadcast to all Clients in the game
+	manager.BroadcastToGame(gameCode, newNextRoundMessage(question, stats))
+}
+
+// NextRoundSendToPlayer sends the next question to a single player, used when every player
+// sees the answers in their own order or the question in their own language
+func NextRoundSendToPlayer(question QuestionDto, stats []StatDto, gameCode string, userId uint) {
+	// Players that are not connected simply miss the round
+	manager.SendToPlayer(gameCode, userId, newNextRoundMessage(question, stats))
+}
+
+func newNextRoundMessage(question QuestionDto, stats []StatDto) *OutgoingMessage {
 	var broadMessage NextRoundEvent
 	broadMessage.Stats = stats
 	broadMessage.Question = question
+	broadMessage.SentAt = time.Now().UnixMilli()
 
-	data, err := json.Marshal(broadMessage)
-	if err != nil {
-		return fmt.Errorf("failed to marshal broadcast message: %v", err)
-	}
+	return NewOutgoingMessage(EventNextRound, broadMessage)
+}
 
-	// Place payload into an Event
-	var outgoingEvent Event
-	outgoingEvent.Payload = data
-	outgoingEvent.Type = EventNextRound
-	// Broadcast to all other Clients
-	for client := range manager.clients {
-		// Only send to clients inside the same chatroom
-		if client.gameCode == gameCode {
-			client.egress <- outgoingEvent
-		}
+func ServerShutdownSend(message string) {
+	manager.Broadcast(NewOutgoingMessage(EventServerShutdown, ServerShutdownEvent{Message: message}))
+}
 
-	}
-	return nil
+func GameOverSend(stats []StatDto, gameCode string) {
+	manager.BroadcastToGame(gameCode, NewOutgoingMessage(EventGameOver, GameOverEvent{Stats: stats}))
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log"
+	"math/big"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	gameCodeLength = 6
+	// gameCodeCharset leaves out characters that are easy to confuse when read out loud: 0/O, 1/l/I
+	gameCodeCharset = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+	// numericCodeCharset is used for kiosks that only have a number pad
+	numericCodeCharset = "0123456789"
+	// gameCodeAttempts is how many codes are tried before giving up on a collision
+	gameCodeAttempts = 10
+	// lobbyTTL is how long a game that never started keeps its code
+	lobbyTTL = 2 * time.Hour
+	// codeExpiryInterval is how often expired codes are released
+	codeExpiryInterval = 5 * time.Minute
+)
+
+var ErrNoFreeGameCode = errors.New("could not find a free game code")
+
+// GenerateGameCode returns a random code, numeric codes only contain digits
+func GenerateGameCode(numeric bool) (string, error) {
+	charset := gameCodeCharset
+	if numeric {
+		charset = numericCodeCharset
+	}
+
+	code := make([]byte, gameCodeLength)
+	max := big.NewInt(int64(len(charset)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = charset[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// SaveGameWithCode assigns the game a code and saves it. Uniqueness among active games is
+// guaranteed by the unique index on ActiveCode, on a collision another code is tried
+func SaveGameWithCode(game *Game, numeric bool) error {
+	for i := 0; i < gameCodeAttempts; i++ {
+		code, err := GenerateGameCode(numeric)
+		if err != nil {
+			return err
+		}
+
+		game.Code = code
+		game.ActiveCode = &code
+
+		err = Db.SaveGame(game)
+		if err == nil {
+			return nil
+		} else if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return err
+		}
+	}
+
+	return ErrNoFreeGameCode
+}
+
+// releaseGameCode lets the code of a finished game be reused by new games
+func releaseGameCode(game *Game) {
+	game.ActiveCode = nil
+}
+
+// ExpireGameCodes finishes lobbies that were never started within lobbyTTL so their
+// codes can be reused
+func ExpireGameCodes() error {
+	games, err := Db.GetExpiredLobbies(time.Now().Add(-lobbyTTL))
+	if err != nil {
+		return err
+	}
+
+	for i := range games {
+		game := &games[i]
+		game.IsActive = false
+		releaseGameCode(game)
+
+		if err := Db.SaveGame(game); err != nil {
+			return err
+		}
+
+		if err := Db.SetAccountsInGame(playerIds(game), false); err != nil {
+			return err
+		}
+
+		log.Printf("expired code of game %s", game.Code)
+	}
+
+	return nil
+}
+
+// ExpireGameCodesPeriodically runs ExpireGameCodes until ctx is done
+func ExpireGameCodesPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(codeExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := ExpireGameCodes(); err != nil {
+				log.Println("failed to expire game codes: ", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// resumeGracePeriod is how long players get to reconnect before a recovered game continues
+	resumeGracePeriod = 15 * time.Second
+	// suspiciousResponseTime is faster than a human can read a question and answer it
+	suspiciousResponseTime = 100 * time.Millisecond
+)
+
+var (
+	ErrServerShuttingDown  = errors.New("server is shutting down and not accepting new games")
+	ErrGameNotRunning      = NewProtocolError(ErrorCodeGameNotRunning, "game is not running")
+	ErrQuestionNotActive   = NewProtocolError(ErrorCodeQuestionNotActive, "question is not open for answers")
+	ErrAnswerTooLate       = NewProtocolError(ErrorCodeAnswerTooLate, "time for this question is up")
+	ErrAlreadyAnswered     = NewProtocolError(ErrorCodeAlreadyAnswered, "question was already answered")
+	ErrAnswerNotInQuestion = NewProtocolError(ErrorCodeInvalidAnswer, "answer does not belong to the question")
+	ErrNotAPlayer          = NewProtocolError(ErrorCodeBadRequest, "player is not part of this game")
+)
+
+// runningGame is the in-memory state of a game whose rounds are being played
+type runningGame struct {
+	sync.Mutex
+	game *Game
+	// deadline is when the currently open question closes
+	deadline time.Time
+	// openedAt is when the currently open question was sent to the players
+	openedAt time.Time
+	// answered holds the players that already answered the open question
+	answered map[uint]bool
+	// audited holds the submissions already audited so repeating one adds no more rows
+	audited map[auditKey]bool
+	// resumeAfter delays the first round of a resumed game so players can reconnect
+	resumeAfter time.Duration
+}
+
+// auditKey identifies a kind of suspicious submission of a player in a round
+type auditKey struct {
+	playerId uint
+	round    uint
+	reason   string
+}
+
+// GameRunner plays games in the background and keeps track of them so they can be
+// finished or checkpointed when the server stops
+type GameRunner struct {
+	sync.Mutex
+	games   map[string]*runningGame
+	closing bool
+
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewGameRunner() *GameRunner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &GameRunner{
+		games:  make(map[string]*runningGame),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// IsAccepting reports whether new games can be created, joined or started
+func (gr *GameRunner) IsAccepting() bool {
+	gr.Lock()
+	defer gr.Unlock()
+
+	return !gr.closing
+}
+
+// StopAccepting makes the runner refuse any new game
+func (gr *GameRunner) StopAccepting() {
+	gr.Lock()
+	defer gr.Unlock()
+
+	gr.closing = true
+}
+
+// Start plays the game in a new goroutine
+func (gr *GameRunner) Start(game *Game) error {
+	return gr.run(&runningGame{game: game})
+}
+
+// Resume continues a checkpointed game from its current question with the time that
+// was left on it
+func (gr *GameRunner) Resume(game *Game) error {
+	game.IsCheckpointed = false
+	return gr.run(&runningGame{game: game, resumeAfter: resumeGracePeriod})
+}
+
+func (gr *GameRunner) run(rg *runningGame) error {
+	gr.Lock()
+	defer gr.Unlock()
+
+	if gr.closing {
+		return ErrServerShuttingDown
+	}
+
+	arrangeQuestions(rg.game)
+	gr.games[rg.game.Code] = rg
+	gr.wg.Add(1)
+
+	go gr.play(rg)
+
+	return nil
+}
+
+// Shutdown stops accepting games and waits for the running ones to finish. Games still
+// running when ctx is done are checkpointed to storage
+func (gr *GameRunner) Shutdown(ctx context.Context) {
+	gr.StopAccepting()
+
+	done := make(chan struct{})
+	go func() {
+		gr.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+
+	log.Println("shutdown deadline reached, checkpointing running games")
+	gr.cancel()
+	<-done
+}
+
+// SubmitAnswer accepts a single answer per player for the open question of a running game
+// and adds its points. Accepted answers are kept for the item analysis, rejected and
+// suspiciously fast submissions are audited
+func (gr *GameRunner) SubmitAnswer(gameCode string, userId uint, questionId uint, answerId uint) error {
+	rg, ok := gr.get(gameCode)
+	if !ok {
+		return ErrGameNotRunning
+	}
+
+	submission := AnswerAudit{
+		PlayerId:   userId,
+		QuestionId: questionId,
+		AnswerId:   answerId,
+	}
+
+	err := rg.submitAnswer(userId, questionId, answerId, &submission)
+	if err != nil {
+		submission.Reason = err.Error()
+	} else {
+		if !rg.isBot(userId) {
+			recordGameAnswer(&submission)
+		}
+		if time.Duration(submission.ResponseTimeMs)*time.Millisecond < suspiciousResponseTime {
+			submission.Reason = "answered faster than " + suspiciousResponseTime.String()
+		}
+	}
+
+	if submission.Reason != "" && !errors.Is(err, ErrNotAPlayer) && rg.firstAudit(userId, submission.Reason) {
+		LogSuspiciousAnswer(&submission)
+	}
+
+	return err
+}
+
+func (rg *runningGame) submitAnswer(userId uint, questionId uint, answerId uint, submission *AnswerAudit) error {
+	now := time.Now()
+
+	rg.Lock()
+	defer rg.Unlock()
+
+	submission.GameId = rg.game.Id
+	submission.ResponseTimeMs = uint(now.Sub(rg.openedAt) / time.Millisecond)
+
+	stat := -1
+	for i := range rg.game.Stats {
+		if rg.game.Stats[i].PlayerId == userId {
+			stat = i
+			break
+		}
+	}
+	if stat < 0 {
+		return ErrNotAPlayer
+	}
+
+	questions := rg.game.Revision.Questions
+	if rg.openedAt.IsZero() || rg.game.CurrentQuestion >= uint(len(questions)) {
+		return ErrQuestionNotActive
+	}
+
+	question := questions[rg.game.CurrentQuestion]
+	if question.Id != questionId {
+		return ErrQuestionNotActive
+	} else if now.After(rg.deadline) {
+		return ErrAnswerTooLate
+	} else if rg.answered[userId] {
+		return ErrAlreadyAnswered
+	}
+
+	for _, answer := range question.Answers {
+		if answer.Id != answerId {
+			continue
+		}
+
+		rg.answered[userId] = true
+		if answer.IsRight {
+			rg.game.Stats[stat].Score += answer.Points
+		}
+		return nil
+	}
+
+	return ErrAnswerNotInQuestion
+}
+
+// isBot reports whether the player is a bot, whose answers are left out of the item analysis
+func (rg *runningGame) isBot(userId uint) bool {
+	rg.Lock()
+	defer rg.Unlock()
+
+	for _, stat := range rg.game.Stats {
+		if stat.PlayerId == userId {
+			return stat.Player.Role == Buser
+		}
+	}
+
+	return false
+}
+
+// firstAudit reports whether the player was not audited for the reason in the current
+// round yet. The round is used instead of the submitted question id, which the player
+// could change with every submission
+func (rg *runningGame) firstAudit(userId uint, reason string) bool {
+	rg.Lock()
+	defer rg.Unlock()
+
+	key := auditKey{playerId: userId, round: rg.game.CurrentQuestion, reason: reason}
+	if rg.audited[key] {
+		return false
+	}
+
+	if rg.audited == nil {
+		rg.audited = make(map[auditKey]bool)
+	}
+	rg.audited[key] = true
+
+	return true
+}
+
+func (gr *GameRunner) get(gameCode string) (*runningGame, bool) {
+	gr.Lock()
+	defer gr.Unlock()
+
+	rg, ok := gr.games[gameCode]
+	return rg, ok
+}
+
+func (gr *GameRunner) remove(gameCode string) {
+	gr.Lock()
+	defer gr.Unlock()
+
+	delete(gr.games, gameCode)
+}
+
+func (gr *GameRunner) play(rg *runningGame) {
+	defer gr.wg.Done()
+	defer gr.remove(rg.game.Code)
+
+	// remaining is only set for the first question of a resumed game
+	remaining := time.Duration(rg.game.RemainingTime) * time.Second
+	if rg.resumeAfter > 0 {
+		if !gr.wait(rg, rg.resumeAfter) {
+			return
+		}
+	}
+
+	questions := rg.game.Revision.Questions
+	for rg.game.CurrentQuestion < uint(len(questions)) {
+		question := questions[rg.game.CurrentQuestion]
+
+		duration := time.Duration(question.Time) * time.Second
+		if remaining > 0 {
+			duration = remaining
+			remaining = 0
+		}
+
+		rg.Lock()
+		rg.openedAt = time.Now()
+		rg.deadline = rg.openedAt.Add(duration)
+		rg.answered = make(map[uint]bool)
+		rg.game.RemainingTime = 0
+		stats := createStatDtos(rg.game.Stats)
+		players := playerIds(rg.game)
+		languages := playerLanguages(rg.game)
+		rg.Unlock()
+
+		// Players get their own copy when their answers are shuffled or the question is
+		// translated, otherwise one copy in the default language is sent to everybody
+		if rg.game.AnswerOrder == AnswerOrderPlayer || hasTranslations(question) {
+			for _, playerId := range players {
+				dto := CreateQuestionDtoForPlayer(rg.game, question, playerId, languages[playerId])
+				NextRoundSendToPlayer(*dto, stats, rg.game.Code, playerId)
+			}
+		} else {
+			NextRoundSend(*CreateQuestionDtoForPlayer(rg.game, question, 0, ""), stats, rg.game.Code)
+		}
+
+		if !gr.wait(rg, time.Until(rg.deadline)) {
+			return
+		}
+
+		// Scores are saved after every round so a crash leaves partial results behind
+		rg.Lock()
+		rg.game.CurrentQuestion++
+		if err := Db.SaveGame(rg.game); err != nil {
+			log.Printf("failed to save round of game %s: %v", rg.game.Code, err)
+		}
+		rg.Unlock()
+	}
+
+	rg.Lock()
+	defer rg.Unlock()
+
+	rg.game.IsInProgress = false
+	rg.game.IsActive = false
+	releaseGameCode(rg.game)
+	if err := Db.SaveGame(rg.game); err != nil {
+		log.Printf("failed to save finished game %s: %v", rg.game.Code, err)
+	}
+
+	if err := Db.SetAccountsInGame(playerIds(rg.game), false); err != nil {
+		log.Printf("failed to release players of game %s: %v", rg.game.Code, err)
+	}
+
+	GameOverSend(createStatDtos(rg.game.Stats), rg.game.Code)
+}
+
+// wait blocks for d and reports false when the runner was cancelled in the meantime,
+// in which case the game has been checkpointed
+func (gr *GameRunner) wait(rg *runningGame, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-gr.ctx.Done():
+		if err := checkpointGame(rg); err != nil {
+			log.Printf("failed to checkpoint game %s: %v", rg.game.Code, err)
+		}
+		return false
+	}
+}
+
+// checkpointGame stores the current question, scores and time left on the open question
+// so the game can be resumed after a restart
+func checkpointGame(rg *runningGame) error {
+	rg.Lock()
+	defer rg.Unlock()
+
+	rg.game.IsCheckpointed = true
+
+	// A resumed game that has not reopened its question yet keeps the stored time
+	if !rg.deadline.IsZero() {
+		remaining := time.Until(rg.deadline)
+		if remaining < 0 {
+			remaining = 0
+		}
+		rg.game.RemainingTime = uint(remaining.Round(time.Second) / time.Second)
+	}
+
+	return Db.SaveGame(rg.game)
+}
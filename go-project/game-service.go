@@ -2,24 +2,15 @@ package main
 
 import (
 	"errors"
-	"math/rand"
+	"log"
 	"time"
 )
 
-func GenerateRandomString(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-
-	rand.New(rand.NewSource(time.Now().UnixNano()))
-	randomString := make([]byte, length)
-
-	for i := range randomString {
-		randomString[i] = charset[rand.Intn(len(charset))]
+func CreateGame(userId uint, role string, body *CreateGameRequest) (string, error) {
+	if !runner.IsAccepting() {
+		return "", ErrServerShuttingDown
 	}
 
-	return string(randomString)
-}
-
-func CreateGame(userId uint, quizId uint) (string, error) {
 	acc, err := Db.GetAccountById(userId)
 	if err != nil {
 		return "", err
@@ -29,38 +20,65 @@ func CreateGame(userId uint, quizId uint) (string, error) {
 		return "", errors.New("cannot create a game user is already in an active one")
 	}
 
-	quiz, err := Db.GetQuizById(quizId)
+	quiz, err := Db.GetQuizById(body.QuizId)
+	if err != nil {
+		return "", err
+	}
+
+	// Buyers keep playing what they paid for even after the quiz was archived
+	if quiz.Status != QuizPublished {
+		if _, err := Db.GetPurchase(acc.Id, quiz.Id); err != nil {
+			return "", ErrQuizNotPublished
+		}
+	}
+
+	revision, err := resolveRevision(quiz, acc.Id, role, body.Revision)
 	if err != nil {
 		return "", err
 	}
 
-	stats := make([]Stat, 1)
-	stats = append(stats, Stat{
+	return startGame(acc, quiz, revision, body)
+}
+
+// startGame opens the lobby of a new game of the revision with the account as its creator
+func startGame(acc *Account, quiz *Quiz, revision *QuizRevision, body *CreateGameRequest) (string, error) {
+	if err := validateGameOptions(body, len(revision.Questions)); err != nil {
+		return "", err
+	}
+
+	seed := time.Now().UnixNano()
+	if body.Seed != nil {
+		seed = *body.Seed
+	}
+
+	stats := []Stat{{
 		PlayerId: acc.Id,
 		Player:   *acc,
 		Score:    0,
-	})
+	}}
 
-	var code string
-	for {
-		code = GenerateRandomString(6)
-		if _, err := Db.GetGameByCode(code); err == nil {
-			break
-		}
+	game := Game{
+		IsActive:         true,
+		IsInProgress:     false,
+		CreatorId:        acc.Id,
+		Creator:          *acc,
+		Stats:            stats,
+		QuizId:           quiz.Id,
+		ActiveQuiz:       *quiz,
+		RevisionId:       revision.Id,
+		Revision:         *revision,
+		CurrentQuestion:  0,
+		Seed:             seed,
+		ShuffleQuestions: body.ShuffleQuestions,
+		AnswerOrder:      body.AnswerOrder,
+		QuestionCount:    body.QuestionCount,
+	}
+	err := SaveGameWithCode(&game, body.NumericCode)
+	if err != nil {
+		return "", err
 	}
 
-	game := Game{
-		IsActive:        true,
-		IsInProgress:    false,
-		Code:            code,
-		CreatorId:       acc.Id,
-		Creator:         *acc,
-		Stats:           stats,
-		QuizId:          quiz.Id,
-		ActiveQuiz:      *quiz,
-		CurrentQuestion: 0,
-	}
-	err = Db.SaveGame(&game)
+	err = Db.SetAccountsInGame([]uint{acc.Id}, true)
 	if err != nil {
 		return "", err
 	}
@@ -69,18 +87,27 @@ func CreateGame(userId uint, quizId uint) (string, error) {
 }
 
 func JoinGame(gameCode string, userId uint) error {
+	if !runner.IsAccepting() {
+		return ErrServerShuttingDown
+	}
+
 	acc, err := Db.GetAccountById(userId)
 	if err != nil {
 		return err
 	}
 
-	if acc.IsInGame {
-		return errors.New("cannot join a game user is already in an active one")
-	}
-
 	game, err := Db.GetGameByCode(gameCode)
 	if err != nil {
 		return err
+	}
+
+	// Players that are already part of the game may reconnect, e.g. after a restart
+	if game.IsActive && isPlayerInGame(game, acc.Id) {
+		return nil
+	}
+
+	if acc.IsInGame {
+		return errors.New("cannot join a game user is already in an active one")
 	} else if game.IsInProgress {
 		return errors.New("cannot join game in progress")
 	}
@@ -96,65 +123,149 @@ func JoinGame(gameCode string, userId uint) error {
 		return err
 	}
 
+	err = Db.SetAccountsInGame([]uint{acc.Id}, true)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// Should be run using gourotine
-func StartGame(gameCode string, userId uint) error {
+// CanConnectToGame checks that the user is a player of the active game before a
+// websocket is opened for them
+func CanConnectToGame(gameCode string, userId uint) error {
 	game, err := Db.GetGameByCode(gameCode)
 	if err != nil {
 		return err
-	} else if game.IsInProgress {
-		return errors.New("cannot start game in progress")
-	} else if game.Creator.Id != userId {
-		return errors.New("cannot start game you are not the creator of")
 	}
 
-	game.IsInProgress = true
-	err = Db.SaveGame(game)
+	if !isPlayerInGame(game, userId) {
+		return errors.New("join the game before connecting to it")
+	}
+
+	return nil
+}
+
+// LeaveGame takes the player out of the lobby so they can create or join another game.
+// The lobby is closed when its creator leaves, releasing everyone who joined it
+func LeaveGame(gameCode string, userId uint) error {
+	game, err := Db.GetGameByCode(gameCode)
 	if err != nil {
 		return err
 	}
 
-	for _, question := range game.ActiveQuiz.Questions {
-		stats := make([]StatDto, 4)
-		for _, stat := range game.Stats {
-			stats = append(stats, *createStatDto(stat))
+	if !isPlayerInGame(game, userId) {
+		return errors.New("cannot leave a game user is not part of")
+	} else if game.IsInProgress {
+		return errors.New("cannot leave game in progress")
+	}
+
+	if game.CreatorId != userId {
+		if err := Db.DeleteStat(game.Id, userId); err != nil {
+			return err
 		}
-		NextRoundSend(*CreateQuestionDto(question), stats, game.Code)
-		timer := time.NewTimer(time.Duration(question.Time) * time.Second)
-		<-timer.C
+
+		manager.DisconnectPlayer(gameCode, userId)
+		return Db.SetAccountsInGame([]uint{userId}, false)
 	}
 
-	game.IsInProgress = false
 	game.IsActive = false
-	err = Db.SaveGame(game)
-	if err != nil {
+	releaseGameCode(game)
+	if err := Db.SaveGame(game); err != nil {
 		return err
 	}
 
-	return nil
+	for _, playerId := range playerIds(game) {
+		manager.DisconnectPlayer(gameCode, playerId)
+	}
+
+	return Db.SetAccountsInGame(playerIds(game), false)
 }
 
-func AddPointsToPlayer(userId uint, gameCode string, points uint) error {
+func StartGame(gameCode string, userId uint) error {
+	if !runner.IsAccepting() {
+		return ErrServerShuttingDown
+	}
+
 	game, err := Db.GetGameByCode(gameCode)
 	if err != nil {
 		return err
+	} else if game.IsInProgress {
+		return errors.New("cannot start game in progress")
+	} else if game.CreatorId != userId {
+		return errors.New("cannot start game you are not the creator of")
 	}
 
-	acc, err := Db.GetAccountById(userId)
+	game.IsInProgress = true
+	err = Db.SaveGame(game)
+	if err != nil {
+		return err
+	}
+
+	return runner.Start(game)
+}
+
+// RecoverGames is run on startup to deal with games left active by a previous process.
+// Checkpointed games are resumed, the rest are finished with the scores stored so far
+func RecoverGames() error {
+	games, err := Db.GetOrphanedGames()
 	if err != nil {
 		return err
 	}
 
-	for i := range game.Stats {
-		if game.Stats[i].Player.Id == acc.Id {
-			game.Stats[i].Score += points
-			break
+	var resumedPlayers []uint
+	for i := range games {
+		game := &games[i]
+
+		if game.IsInProgress && game.IsCheckpointed {
+			if err := runner.Resume(game); err != nil {
+				return err
+			}
+
+			log.Printf("resumed game %s at question %d", game.Code, game.CurrentQuestion)
+			resumedPlayers = append(resumedPlayers, playerIds(game)...)
+			continue
+		}
+
+		game.IsActive = false
+		game.IsInProgress = false
+		releaseGameCode(game)
+		if err := Db.SaveGame(game); err != nil {
+			return err
 		}
+
+		log.Printf("finished orphaned game %s with partial results", game.Code)
 	}
 
-	return nil
+	return Db.ClearInGameFlags(resumedPlayers)
+}
+
+func isPlayerInGame(game *Game, userId uint) bool {
+	for _, stat := range game.Stats {
+		if stat.PlayerId == userId {
+			return true
+		}
+	}
+
+	return false
+}
+
+func playerIds(game *Game) []uint {
+	ids := make([]uint, 0, len(game.Stats))
+	for _, stat := range game.Stats {
+		ids = append(ids, stat.PlayerId)
+	}
+
+	return ids
+}
+
+func createStatDtos(stats []Stat) []StatDto {
+	statsDto := make([]StatDto, 0, len(stats))
+	for _, stat := range stats {
+		statsDto = append(statsDto, *createStatDto(stat))
+	}
+
+	return statsDto
 }
 
 func createStatDto(stat Stat) *StatDto {
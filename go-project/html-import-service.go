@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	defaultImportTime   = 30
+	defaultImportPoints = 1
+	// maxImportSize limits uploaded documents
+	maxImportSize = 5 << 20
+)
+
+// defaultHtmlImportRules are used for every selector missing from the given rules
+var defaultHtmlImportRules = HtmlImportRules{
+	Name:         "h1",
+	Description:  "p.description",
+	Question:     ".question",
+	QuestionText: ".question-text",
+	Answer:       "li",
+	RightAnswer:  ".correct",
+	Time:         defaultImportTime,
+	Points:       defaultImportPoints,
+}
+
+// ParseHtmlImportRules reads rules given as JSON, missing selectors use the defaults
+func ParseHtmlImportRules(data []byte) (HtmlImportRules, error) {
+	rules := defaultHtmlImportRules
+	if len(data) == 0 {
+		return rules, nil
+	}
+
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return rules, fmt.Errorf("invalid import rules: %v", err)
+	}
+
+	if rules.Question == "" || rules.Answer == "" {
+		return rules, errors.New("import rules need a question and an answer selector")
+	}
+
+	return rules, nil
+}
+
+// ParseHtmlQuiz extracts a quiz from the document using the rules. Nothing is saved, the
+// result can be shown to the user as a preview
+func ParseHtmlQuiz(document io.Reader, rules HtmlImportRules) (*QuizImportPreview, error) {
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(document, maxImportSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var preview QuizImportPreview
+	preview.Name = selectText(doc.Selection, rules.Name)
+	preview.Description = selectText(doc.Selection, rules.Description)
+	if preview.Name == "" {
+		preview.Name = strings.TrimSpace(doc.Find("title").First().Text())
+	}
+
+	doc.Find(rules.Question).Each(func(i int, block *goquery.Selection) {
+		question := QuestionData{
+			Text: selectText(block, rules.QuestionText),
+			Time: rules.Time,
+		}
+		if question.Text == "" {
+			question.Text = ownText(block)
+		}
+
+		block.Find(rules.Answer).Each(func(j int, item *goquery.Selection) {
+			isRight := rules.RightAnswer != "" && (item.Is(rules.RightAnswer) || item.Find(rules.RightAnswer).Length() > 0)
+
+			answer := AnswerData{
+				Text:    strings.TrimSpace(item.Text()),
+				IsRight: isRight,
+			}
+			if isRight {
+				answer.Points = rules.Points
+			}
+
+			question.Answers = append(question.Answers, answer)
+		})
+
+		if question.Text == "" {
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("question %d has no text", i+1))
+		}
+		if len(question.Answers) == 0 {
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("question %d has no answers", i+1))
+		} else if !hasRightAnswer(question) {
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("question %d has no right answer", i+1))
+		}
+
+		preview.Questions = append(preview.Questions, question)
+	})
+
+	if len(preview.Questions) == 0 {
+		return nil, fmt.Errorf("no questions matched the selector %q", rules.Question)
+	}
+
+	return &preview, nil
+}
+
+// ImportHtmlQuiz parses the document and saves the result as a quiz of the user unless
+// only a preview was asked for
+func ImportHtmlQuiz(document io.Reader, rules HtmlImportRules, userId uint, preview bool) (*QuizImportPreview, error) {
+	result, err := ParseHtmlQuiz(document, rules)
+	if err != nil || preview {
+		return result, err
+	}
+
+	quiz, err := CreateQuiz(CreateQuizRequestFromData(&result.QuizData), userId)
+	if err != nil {
+		return nil, err
+	}
+
+	result.QuizId = quiz.Id
+	return result, nil
+}
+
+func selectText(s *goquery.Selection, selector string) string {
+	if selector == "" {
+		return ""
+	}
+
+	return strings.TrimSpace(s.Find(selector).First().Text())
+}
+
+// ownText is the text of the element without the text of its children
+func ownText(s *goquery.Selection) string {
+	var text strings.Builder
+	s.Contents().Each(func(i int, node *goquery.Selection) {
+		if goquery.NodeName(node) == "#text" {
+			text.WriteString(node.Text())
+		}
+	})
+
+	return strings.TrimSpace(text.String())
+}
+
+func hasRightAnswer(question QuestionData) bool {
+	for _, answer := range question.Answers {
+		if answer.IsRight {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RunImportHtml is the import-html command. It prints what was detected in the document
+// and saves it as a quiz of the given owner when -save is passed
+func RunImportHtml(args []string) error {
+	flags := flag.NewFlagSet("import-html", flag.ContinueOnError)
+	path := flags.String("file", "", "path of the HTML document")
+	rulesPath := flags.String("rules", "", "path of a JSON file with the CSS selector rules")
+	owner := flags.String("owner", "", "username of the account the quiz is saved for")
+	save := flags.Bool("save", false, "save the quiz instead of only previewing it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *path == "" {
+		return errors.New("-file is required")
+	}
+
+	var rulesData []byte
+	if *rulesPath != "" {
+		data, err := os.ReadFile(*rulesPath)
+		if err != nil {
+			return err
+		}
+		rulesData = data
+	}
+
+	rules, err := ParseHtmlImportRules(rulesData)
+	if err != nil {
+		return err
+	}
+
+	document, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer document.Close()
+
+	var userId uint
+	if *save {
+		if *owner == "" {
+			return errors.New("-owner is required to save the quiz")
+		}
+
+		if err := NewMySqlStore(); err != nil {
+			return err
+		}
+		defer Db.Close()
+
+		acc, err := Db.GetAccountByUsername(*owner)
+		if err != nil {
+			return err
+		}
+		userId = acc.Id
+	}
+
+	result, err := ImportHtmlQuiz(document, rules, userId, !*save)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
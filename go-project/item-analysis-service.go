@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// discriminationGroup is the share of the best and of the worst players whose results are
+// compared for the discrimination index
+const discriminationGroup = 0.27
+
+var ErrNotQuizAuthor = errors.New("only the authors of the quiz can see how its questions perform")
+
+var analysisCsvHeader = []string{"position", "question", "players", "answered", "percent_correct", "average_response_ms",
+	"discrimination", "answer", "is_right", "selected", "percent_selected"}
+
+// analysisAttempt is one player in one game, ranked by the score of the game
+type analysisAttempt struct {
+	gameId   uint
+	playerId uint
+	score    uint
+}
+
+type attemptKey struct {
+	gameId   uint
+	playerId uint
+}
+
+// recordGameAnswer keeps an accepted answer for the item analysis. The points are already
+// added, so a lost row only leaves the answer out of the statistics
+func recordGameAnswer(submission *AnswerAudit) {
+	answer := GameAnswer{
+		GameId:         submission.GameId,
+		PlayerId:       submission.PlayerId,
+		QuestionId:     submission.QuestionId,
+		AnswerId:       submission.AnswerId,
+		ResponseTimeMs: submission.ResponseTimeMs,
+	}
+
+	if err := Db.PostGameAnswer(&answer); err != nil {
+		log.Println("failed to store game answer: ", err)
+	}
+}
+
+// GetQuizAnalysis computes how the questions of the revision performed in its finished
+// games, the latest revision when no number is given. Only the authors may see it
+func GetQuizAnalysis(quizId uint, userId uint, role string, number uint) (*QuizAnalysisDto, error) {
+	quiz, err := Db.GetQuizById(quizId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canEditQuiz(quiz, userId, role) {
+		return nil, ErrNotQuizAuthor
+	}
+
+	if number == 0 {
+		number = quiz.LatestRevision
+	}
+	if number == 0 {
+		return nil, ErrNoPublishedRevision
+	}
+
+	revision, err := Db.GetQuizRevision(quiz.Id, number)
+	if err != nil {
+		return nil, err
+	}
+
+	games, err := Db.GetPlayedGamesByRevisionId(revision.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	gameIds := make([]uint, 0, len(games))
+	for _, game := range games {
+		gameIds = append(gameIds, game.Id)
+	}
+
+	answers, err := Db.GetGameAnswersByGameIds(gameIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return analyzeRevision(quiz.Id, revision, games, answers), nil
+}
+
+// ExportQuizAnalysis writes the analysis as CSV with a row for every answer of every question
+func ExportQuizAnalysis(quizId uint, userId uint, role string, number uint) ([]byte, error) {
+	analysis, err := GetQuizAnalysis(quizId, userId, role, number)
+	if err != nil {
+		return nil, err
+	}
+
+	return formatAnalysisCsv(analysis)
+}
+
+func formatAnalysisCsv(analysis *QuizAnalysisDto) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(analysisCsvHeader)
+
+	for _, question := range analysis.Questions {
+		discrimination := ""
+		if question.Discrimination != nil {
+			discrimination = formatStatistic(*question.Discrimination)
+		}
+
+		record := []string{
+			strconv.Itoa(question.Position),
+			question.Text,
+			strconv.Itoa(question.Players),
+			strconv.Itoa(question.Answered),
+			formatStatistic(question.PercentCorrect),
+			formatStatistic(question.AverageResponseMs),
+			discrimination,
+		}
+
+		for _, answer := range question.Answers {
+			writer.Write(append(slices.Clone(record),
+				answer.Text,
+				strconv.FormatBool(answer.IsRight),
+				strconv.Itoa(answer.Selected),
+				formatStatistic(answer.PercentSelected),
+			))
+		}
+	}
+
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// analyzeRevision computes the statistics of every question of the revision. The questions
+// a game asked are drawn again from its seed, so players who never saw a question do not
+// count against it. Bots answer by chance and are left out, like games only bots played
+func analyzeRevision(quizId uint, revision *QuizRevision, games []Game, answers []GameAnswer) *QuizAnalysisDto {
+	asked := make(map[uint]map[uint]bool, len(games))
+	var attempts []analysisAttempt
+	humanGames := 0
+	for _, game := range games {
+		humans := 0
+		for _, stat := range game.Stats {
+			if stat.Player.Role != Buser {
+				attempts = append(attempts, analysisAttempt{gameId: game.Id, playerId: stat.PlayerId, score: stat.Score})
+				humans++
+			}
+		}
+		if humans == 0 {
+			continue
+		}
+		humanGames++
+
+		game.Revision = QuizRevision{Questions: slices.Clone(revision.Questions)}
+		arrangeQuestions(&game)
+
+		played := game.Revision.Questions
+		if int(game.CurrentQuestion) < len(played) {
+			played = played[:game.CurrentQuestion]
+		}
+
+		asked[game.Id] = make(map[uint]bool, len(played))
+		for _, question := range played {
+			asked[game.Id][question.Id] = true
+		}
+	}
+
+	chosen := make(map[attemptKey]map[uint]GameAnswer, len(attempts))
+	for _, answer := range answers {
+		key := attemptKey{answer.GameId, answer.PlayerId}
+		if chosen[key] == nil {
+			chosen[key] = make(map[uint]GameAnswer)
+		}
+		chosen[key][answer.QuestionId] = answer
+	}
+
+	top, bottom := discriminationGroups(attempts)
+
+	analysis := QuizAnalysisDto{
+		QuizId:    quizId,
+		Revision:  revision.Number,
+		Games:     humanGames,
+		Players:   len(attempts),
+		Questions: make([]QuestionAnalysisDto, 0, len(revision.Questions)),
+	}
+
+	for i, question := range revision.Questions {
+		right := make(map[uint]bool, len(question.Answers))
+		selected := make(map[uint]int, len(question.Answers))
+		for _, answer := range question.Answers {
+			right[answer.Id] = answer.IsRight
+		}
+
+		isCorrect := func(attempt analysisAttempt) bool {
+			answer, ok := chosen[attemptKey{attempt.gameId, attempt.playerId}][question.Id]
+			return ok && right[answer.AnswerId]
+		}
+
+		dto := QuestionAnalysisDto{
+			QuestionId: question.Id,
+			Position:   i + 1,
+			Text:       question.Text,
+		}
+
+		var correct int
+		var responseMs uint
+		for _, attempt := range attempts {
+			if !asked[attempt.gameId][question.Id] {
+				continue
+			}
+			dto.Players++
+
+			answer, ok := chosen[attemptKey{attempt.gameId, attempt.playerId}][question.Id]
+			if !ok {
+				continue
+			}
+
+			dto.Answered++
+			responseMs += answer.ResponseTimeMs
+			selected[answer.AnswerId]++
+			if right[answer.AnswerId] {
+				correct++
+			}
+		}
+
+		dto.PercentCorrect = percentOf(correct, dto.Players)
+		if dto.Answered > 0 {
+			dto.AverageResponseMs = float64(responseMs) / float64(dto.Answered)
+		}
+
+		topShare, topAsked := shareCorrect(top, asked, question.Id, isCorrect)
+		bottomShare, bottomAsked := shareCorrect(bottom, asked, question.Id, isCorrect)
+		if topAsked > 0 && bottomAsked > 0 {
+			discrimination := topShare - bottomShare
+			dto.Discrimination = &discrimination
+		}
+
+		dto.Answers = make([]AnswerAnalysisDto, 0, len(question.Answers))
+		for _, answer := range question.Answers {
+			dto.Answers = append(dto.Answers, AnswerAnalysisDto{
+				AnswerId:        answer.Id,
+				Text:            answer.Text,
+				IsRight:         answer.IsRight,
+				Selected:        selected[answer.Id],
+				PercentSelected: percentOf(selected[answer.Id], dto.Players),
+			})
+		}
+
+		analysis.Questions = append(analysis.Questions, dto)
+	}
+
+	return &analysis
+}
+
+// discriminationGroups returns the best and the worst scoring attempts, each group holds
+// the same share of all attempts and they never overlap
+func discriminationGroups(attempts []analysisAttempt) ([]analysisAttempt, []analysisAttempt) {
+	ranked := slices.Clone(attempts)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
+
+	size := int(math.Ceil(float64(len(ranked)) * discriminationGroup))
+	if size > len(ranked)/2 {
+		size = len(ranked) / 2
+	}
+
+	return ranked[:size], ranked[len(ranked)-size:]
+}
+
+// shareCorrect returns the share of the group that answered the question correctly among
+// those it was asked to, together with their number
+func shareCorrect(group []analysisAttempt, asked map[uint]map[uint]bool, questionId uint, isCorrect func(analysisAttempt) bool) (float64, int) {
+	var total, correct int
+	for _, attempt := range group {
+		if !asked[attempt.gameId][questionId] {
+			continue
+		}
+		total++
+		if isCorrect(attempt) {
+			correct++
+		}
+	}
+
+	if total == 0 {
+		return 0, 0
+	}
+
+	return float64(correct) / float64(total), total
+}
+
+func percentOf(count int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return 100 * float64(count) / float64(total)
+}
+
+func formatStatistic(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func analysisRevision() *QuizRevision {
+	return &QuizRevision{
+		Number: 3,
+		Questions: []Question{
+			{Id: 1, Text: "Capital of France?", Answers: []Answer{
+				{Id: 11, Text: "Paris", IsRight: true, Points: 10},
+				{Id: 12, Text: "Lyon"},
+				{Id: 13, Text: "Nice"},
+			}},
+			{Id: 2, Text: "Capital of Italy?", Answers: []Answer{
+				{Id: 21, Text: "Milan"},
+				{Id: 22, Text: "Rome", IsRight: true, Points: 10},
+			}},
+		},
+	}
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+func TestAnalyzeRevision(t *testing.T) {
+	games := []Game{{
+		Id:              5,
+		CurrentQuestion: 2,
+		Stats: []Stat{
+			{PlayerId: 1, Score: 20},
+			{PlayerId: 2, Score: 10},
+			{PlayerId: 3, Score: 10},
+			{PlayerId: 4, Score: 0},
+		},
+	}}
+	answers := []GameAnswer{
+		{GameId: 5, PlayerId: 1, QuestionId: 1, AnswerId: 11, ResponseTimeMs: 1000},
+		{GameId: 5, PlayerId: 2, QuestionId: 1, AnswerId: 11, ResponseTimeMs: 2000},
+		{GameId: 5, PlayerId: 3, QuestionId: 1, AnswerId: 12, ResponseTimeMs: 3000},
+		{GameId: 5, PlayerId: 4, QuestionId: 1, AnswerId: 13, ResponseTimeMs: 4000},
+		{GameId: 5, PlayerId: 1, QuestionId: 2, AnswerId: 22, ResponseTimeMs: 500},
+		{GameId: 5, PlayerId: 2, QuestionId: 2, AnswerId: 21, ResponseTimeMs: 1500},
+		{GameId: 5, PlayerId: 3, QuestionId: 2, AnswerId: 22, ResponseTimeMs: 2500},
+		// Player 4 let the time for question 2 run out
+	}
+
+	got := analyzeRevision(9, analysisRevision(), games, answers)
+
+	// Players 1 and 2 are the top group, 3 and 4 the bottom one
+	want := &QuizAnalysisDto{
+		QuizId:   9,
+		Revision: 3,
+		Games:    1,
+		Players:  4,
+		Questions: []QuestionAnalysisDto{
+			{
+				QuestionId:        1,
+				Position:          1,
+				Text:              "Capital of France?",
+				Players:           4,
+				Answered:          4,
+				PercentCorrect:    50,
+				AverageResponseMs: 2500,
+				Discrimination:    floatPtr(1),
+				Answers: []AnswerAnalysisDto{
+					{AnswerId: 11, Text: "Paris", IsRight: true, Selected: 2, PercentSelected: 50},
+					{AnswerId: 12, Text: "Lyon", Selected: 1, PercentSelected: 25},
+					{AnswerId: 13, Text: "Nice", Selected: 1, PercentSelected: 25},
+				},
+			},
+			{
+				QuestionId:        2,
+				Position:          2,
+				Text:              "Capital of Italy?",
+				Players:           4,
+				Answered:          3,
+				PercentCorrect:    50,
+				AverageResponseMs: 1500,
+				Discrimination:    floatPtr(0),
+				Answers: []AnswerAnalysisDto{
+					{AnswerId: 21, Text: "Milan", Selected: 1, PercentSelected: 25},
+					{AnswerId: 22, Text: "Rome", IsRight: true, Selected: 2, PercentSelected: 50},
+				},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("analyzeRevision() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestAnalyzeRevisionCountsOnlyAskedPlayers(t *testing.T) {
+	games := []Game{
+		{Id: 5, CurrentQuestion: 2, Stats: []Stat{{PlayerId: 1, Score: 10}, {PlayerId: 2, Score: 0}}},
+		// The game stopped after the first question, its players never saw the second
+		{Id: 6, CurrentQuestion: 1, Stats: []Stat{{PlayerId: 1, Score: 10}, {PlayerId: 3, Score: 0}}},
+	}
+	answers := []GameAnswer{
+		{GameId: 5, PlayerId: 1, QuestionId: 1, AnswerId: 11, ResponseTimeMs: 1000},
+		{GameId: 5, PlayerId: 2, QuestionId: 1, AnswerId: 12, ResponseTimeMs: 1000},
+		{GameId: 5, PlayerId: 1, QuestionId: 2, AnswerId: 21, ResponseTimeMs: 1000},
+		{GameId: 5, PlayerId: 2, QuestionId: 2, AnswerId: 22, ResponseTimeMs: 1000},
+		{GameId: 6, PlayerId: 1, QuestionId: 1, AnswerId: 11, ResponseTimeMs: 1000},
+	}
+
+	got := analyzeRevision(9, analysisRevision(), games, answers)
+	if got.Games != 2 || got.Players != 4 {
+		t.Fatalf("games = %d, players = %d, want 2 and 4", got.Games, got.Players)
+	}
+
+	first, second := got.Questions[0], got.Questions[1]
+	if first.Players != 4 || first.Answered != 3 || first.PercentCorrect != 50 {
+		t.Errorf("first question: players %d, answered %d, correct %v, want 4, 3 and 50", first.Players, first.Answered, first.PercentCorrect)
+	}
+	if second.Players != 2 || second.Answered != 2 || second.PercentCorrect != 50 {
+		t.Errorf("second question: players %d, answered %d, correct %v, want 2, 2 and 50", second.Players, second.Answered, second.PercentCorrect)
+	}
+
+	// The top group is player 1 in both games, the bottom one players 2 and 3. Only the
+	// players of game 5 were asked the second question, and only player 2 got it right
+	if first.Discrimination == nil || *first.Discrimination != 1 {
+		t.Errorf("first question discrimination = %v, want 1", first.Discrimination)
+	}
+	if second.Discrimination == nil || *second.Discrimination != -1 {
+		t.Errorf("second question discrimination = %v, want -1", second.Discrimination)
+	}
+}
+
+func TestAnalyzeRevisionLeavesOutBots(t *testing.T) {
+	bot := Account{Role: Buser}
+	games := []Game{
+		{Id: 5, CurrentQuestion: 2, Stats: []Stat{{PlayerId: 1, Score: 10}, {PlayerId: 2, Player: bot, Score: 20}}},
+		// Bots testing a quiz on their own are no game
+		{Id: 6, CurrentQuestion: 2, Stats: []Stat{{PlayerId: 2, Player: bot, Score: 20}}},
+	}
+	answers := []GameAnswer{
+		{GameId: 5, PlayerId: 1, QuestionId: 1, AnswerId: 12, ResponseTimeMs: 1000},
+		{GameId: 5, PlayerId: 2, QuestionId: 1, AnswerId: 11, ResponseTimeMs: 200},
+		{GameId: 6, PlayerId: 2, QuestionId: 1, AnswerId: 11, ResponseTimeMs: 200},
+	}
+
+	got := analyzeRevision(9, analysisRevision(), games, answers)
+	if got.Games != 1 || got.Players != 1 {
+		t.Fatalf("games = %d, players = %d, want 1 and 1", got.Games, got.Players)
+	}
+
+	question := got.Questions[0]
+	if question.Answered != 1 || question.PercentCorrect != 0 || question.AverageResponseMs != 1000 {
+		t.Errorf("answered %d, correct %v, response %v, want 1, 0 and 1000", question.Answered, question.PercentCorrect, question.AverageResponseMs)
+	}
+}
+
+func TestAnalyzeRevisionWithoutPlayers(t *testing.T) {
+	got := analyzeRevision(9, analysisRevision(), nil, nil)
+
+	for _, question := range got.Questions {
+		if question.Players != 0 || question.PercentCorrect != 0 || question.AverageResponseMs != 0 || question.Discrimination != nil {
+			t.Errorf("question %d without players = %+v", question.QuestionId, question)
+		}
+		for _, answer := range question.Answers {
+			if answer.Selected != 0 || answer.PercentSelected != 0 {
+				t.Errorf("answer %d without players = %+v", answer.AnswerId, answer)
+			}
+		}
+	}
+}
+
+func TestAnalyzeRevisionSinglePlayer(t *testing.T) {
+	games := []Game{{Id: 5, CurrentQuestion: 2, Stats: []Stat{{PlayerId: 1, Score: 10}}}}
+	answers := []GameAnswer{{GameId: 5, PlayerId: 1, QuestionId: 1, AnswerId: 11, ResponseTimeMs: 750}}
+
+	got := analyzeRevision(9, analysisRevision(), games, answers)
+
+	question := got.Questions[0]
+	if question.PercentCorrect != 100 || question.AverageResponseMs != 750 {
+		t.Errorf("correct %v, response %v, want 100 and 750", question.PercentCorrect, question.AverageResponseMs)
+	}
+	// A single player cannot be in both the top and the bottom group
+	if question.Discrimination != nil {
+		t.Errorf("discrimination = %v, want nil", *question.Discrimination)
+	}
+}
+
+func TestDiscriminationGroups(t *testing.T) {
+	attempts := func(scores ...uint) []analysisAttempt {
+		var result []analysisAttempt
+		for i, score := range scores {
+			result = append(result, analysisAttempt{gameId: 1, playerId: uint(i + 1), score: score})
+		}
+		return result
+	}
+
+	players := func(group []analysisAttempt) []uint {
+		ids := []uint{}
+		for _, attempt := range group {
+			ids = append(ids, attempt.playerId)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name   string
+		scores []uint
+		top    []uint
+		bottom []uint
+	}{
+		{"no players", nil, []uint{}, []uint{}},
+		{"one player is in no group", []uint{5}, []uint{}, []uint{}},
+		{"two players", []uint{1, 9}, []uint{2}, []uint{1}},
+		// 27% of 3 rounds up to 1, the middle player is in neither group
+		{"three players", []uint{5, 9, 1}, []uint{2}, []uint{3}},
+		// 27% of 4 rounds up to 2, which is still half
+		{"four players", []uint{3, 8, 1, 6}, []uint{2, 4}, []uint{1, 3}},
+		{"ten players", []uint{10, 9, 8, 7, 6, 5, 4, 3, 2, 1}, []uint{1, 2, 3}, []uint{8, 9, 10}},
+		// Ties keep the order the players were found in
+		{"ties", []uint{5, 5, 5, 5}, []uint{1, 2}, []uint{3, 4}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := attempts(test.scores...)
+			top, bottom := discriminationGroups(input)
+
+			if got := players(top); !reflect.DeepEqual(got, test.top) {
+				t.Errorf("top = %v, want %v", got, test.top)
+			}
+			if got := players(bottom); !reflect.DeepEqual(got, test.bottom) {
+				t.Errorf("bottom = %v, want %v", got, test.bottom)
+			}
+			if !reflect.DeepEqual(input, attempts(test.scores...)) {
+				t.Errorf("attempts were reordered")
+			}
+		})
+	}
+}
+
+func TestShareCorrect(t *testing.T) {
+	group := []analysisAttempt{{gameId: 1, playerId: 1}, {gameId: 1, playerId: 2}, {gameId: 2, playerId: 3}}
+	asked := map[uint]map[uint]bool{1: {7: true}, 2: {}}
+	correct := func(attempt analysisAttempt) bool { return attempt.playerId == 1 }
+
+	share, total := shareCorrect(group, asked, 7, correct)
+	if math.Abs(share-0.5) > 1e-9 || total != 2 {
+		t.Errorf("shareCorrect() = %v, %d, want 0.5 and 2", share, total)
+	}
+
+	if share, total := shareCorrect(group, asked, 8, correct); share != 0 || total != 0 {
+		t.Errorf("shareCorrect() of a question nobody was asked = %v, %d, want 0 and 0", share, total)
+	}
+}
+
+func TestAnalysisCsvRows(t *testing.T) {
+	analysis := analyzeRevision(9, analysisRevision(), []Game{{
+		Id:              5,
+		CurrentQuestion: 2,
+		Stats:           []Stat{{PlayerId: 1, Score: 10}, {PlayerId: 2, Score: 0}, {PlayerId: 3, Score: 0}},
+	}}, []GameAnswer{
+		{GameId: 5, PlayerId: 1, QuestionId: 1, AnswerId: 11, ResponseTimeMs: 1000},
+		{GameId: 5, PlayerId: 2, QuestionId: 1, AnswerId: 12, ResponseTimeMs: 2000},
+	})
+
+	out, err := formatAnalysisCsv(analysis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		analysisCsvHeader,
+		{"1", "Capital of France?", "3", "2", "33.33", "1500.00", "1.00", "Paris", "true", "1", "33.33"},
+		{"1", "Capital of France?", "3", "2", "33.33", "1500.00", "1.00", "Lyon", "false", "1", "33.33"},
+		{"1", "Capital of France?", "3", "2", "33.33", "1500.00", "1.00", "Nice", "false", "0", "0.00"},
+		{"2", "Capital of Italy?", "3", "0", "0.00", "0.00", "0.00", "Milan", "false", "0", "0.00"},
+		{"2", "Capital of Italy?", "3", "0", "0.00", "0.00", "0.00", "Rome", "true", "0", "0.00"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("csv =\n%v\nwant\n%v", records, want)
+	}
+}
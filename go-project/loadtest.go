@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// loadTestConfig holds the flags of the loadtest command
+type loadTestConfig struct {
+	addr       string
+	games      int
+	bots       uint
+	quizId     uint
+	user       string
+	password   string
+	difficulty string
+	timeout    time.Duration
+}
+
+// loadTestResult is what a single game of the load test reports back
+type loadTestResult struct {
+	requests   map[string][]time.Duration
+	broadcasts []time.Duration
+	rounds     int
+	err        error
+}
+
+// RunLoadTest is the loadtest command. It plays games with bots against a running server,
+// game i is created by the account <user><i> which has to exist and use the given password
+func RunLoadTest(args []string) error {
+	var cfg loadTestConfig
+
+	flags := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	flags.StringVar(&cfg.addr, "addr", "http://localhost:3000", "address of the running server")
+	flags.IntVar(&cfg.games, "games", 1, "number of games to play at the same time")
+	flags.UintVar(&cfg.bots, "bots", 10, "number of bots in every game")
+	flags.UintVar(&cfg.quizId, "quiz", 0, "id of the quiz the games are played with")
+	flags.StringVar(&cfg.user, "user", "loadtest", "username prefix of the accounts creating the games")
+	flags.StringVar(&cfg.password, "password", "", "password of the accounts creating the games")
+	flags.StringVar(&cfg.difficulty, "difficulty", BotMedium, "difficulty of the bots")
+	flags.DurationVar(&cfg.timeout, "timeout", 10*time.Minute, "how long to wait for a game to finish")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if cfg.quizId == 0 {
+		return fmt.Errorf("-quiz is required")
+	}
+
+	start := time.Now()
+	results := make([]loadTestResult, cfg.games)
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.games; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = playLoadTestGame(&cfg, fmt.Sprintf("%s%d", cfg.user, i+1))
+		}(i)
+	}
+	wg.Wait()
+
+	printLoadTestReport(results, time.Since(start))
+	return nil
+}
+
+// loadTestSession is one logged in account of the load test. The session cookie is kept
+// by hand because the server marks it Secure, which a cookie jar refuses over plain http
+type loadTestSession struct {
+	client  *http.Client
+	addr    string
+	cookies []*http.Cookie
+	result  *loadTestResult
+}
+
+func playLoadTestGame(cfg *loadTestConfig, username string) loadTestResult {
+	result := loadTestResult{requests: make(map[string][]time.Duration)}
+	session := &loadTestSession{
+		client: &http.Client{Timeout: 30 * time.Second},
+		addr:   cfg.addr,
+		result: &result,
+	}
+
+	if err := session.post("login", "/api/login", LoginRequest{Username: username, Password: cfg.password}, nil); err != nil {
+		result.err = fmt.Errorf("%s: login: %v", username, err)
+		return result
+	}
+
+	var created CreateGameResponse
+	if err := session.post("create", "/game/create", CreateGameRequest{QuizId: cfg.quizId}, &created); err != nil {
+		result.err = fmt.Errorf("%s: create game: %v", username, err)
+		return result
+	}
+
+	conn, err := session.dial("/game/" + created.Code + "/ws")
+	if err != nil {
+		result.err = fmt.Errorf("%s: connect: %v", username, err)
+		return result
+	}
+	defer conn.Close()
+
+	bots := AddBotsRequest{Count: cfg.bots, Difficulty: cfg.difficulty}
+	if err := session.post("bots", "/game/"+created.Code+"/bots", bots, nil); err != nil {
+		result.err = fmt.Errorf("%s: add bots: %v", username, err)
+		return result
+	}
+
+	if err := session.post("start", "/game/"+created.Code+"/start", nil, nil); err != nil {
+		result.err = fmt.Errorf("%s: start game: %v", username, err)
+		return result
+	}
+
+	conn.SetReadDeadline(time.Now().Add(cfg.timeout))
+	for {
+		var event Event
+		if err := conn.ReadJSON(&event); err != nil {
+			result.err = fmt.Errorf("%s: read: %v", username, err)
+			return result
+		}
+		received := time.Now()
+
+		switch event.Type {
+		case EventNextRound:
+			var round NextRoundEvent
+			if err := json.Unmarshal(event.Payload, &round); err != nil {
+				result.err = err
+				return result
+			}
+			result.rounds++
+			result.broadcasts = append(result.broadcasts, received.Sub(time.UnixMilli(round.SentAt)))
+		case EventGameOver:
+			return result
+		case EventServerShutdown:
+			result.err = fmt.Errorf("%s: server shut down", username)
+			return result
+		}
+	}
+}
+
+// post sends body as JSON, decodes the response into out and records the latency under name
+func (s *loadTestSession) post(name string, path string, body interface{}, out interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest("POST", s.addr+path, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for _, cookie := range s.cookies {
+		req.AddCookie(cookie)
+	}
+
+	start := time.Now()
+	res, err := s.client.Do(req)
+	s.result.requests[name] = append(s.result.requests[name], time.Since(start))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	if cookies := res.Cookies(); len(cookies) > 0 {
+		s.cookies = cookies
+	}
+
+	if out != nil {
+		return json.NewDecoder(res.Body).Decode(out)
+	}
+
+	return nil
+}
+
+func (s *loadTestSession) dial(path string) (*websocket.Conn, error) {
+	header := http.Header{}
+	for _, cookie := range s.cookies {
+		header.Add("Cookie", cookie.Name+"="+cookie.Value)
+	}
+
+	wsUrl := strings.Replace(s.addr, "http", "ws", 1) + path
+	conn, _, err := websocket.DefaultDialer.Dial(wsUrl, header)
+	return conn, err
+}
+
+func printLoadTestReport(results []loadTestResult, took time.Duration) {
+	requests := make(map[string][]time.Duration)
+	var broadcasts []time.Duration
+	failed, rounds := 0, 0
+
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+			fmt.Println("error:", result.err)
+		}
+
+		for name, durations := range result.requests {
+			requests[name] = append(requests[name], durations...)
+		}
+		broadcasts = append(broadcasts, result.broadcasts...)
+		rounds += result.rounds
+	}
+
+	fmt.Printf("games: %d, failed: %d, rounds received: %d, took: %v\n", len(results), failed, rounds, took.Round(time.Millisecond))
+
+	names := make([]string, 0, len(requests))
+	for name := range requests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Printf("%-10s %s\n", name, formatDurations(requests[name]))
+	}
+	fmt.Printf("%-10s %s\n", "broadcast", formatDurations(broadcasts))
+}
+
+// formatDurations prints min, mean, p95 and max of the durations
+func formatDurations(durations []time.Duration) string {
+	if len(durations) == 0 {
+		return "no samples"
+	}
+
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	p95 := sorted[(len(sorted)-1)*95/100]
+
+	return fmt.Sprintf("n=%d min=%v mean=%v p95=%v max=%v",
+		len(sorted),
+		sorted[0].Round(time.Microsecond),
+		(total / time.Duration(len(sorted))).Round(time.Microsecond),
+		p95.Round(time.Microsecond),
+		sorted[len(sorted)-1].Round(time.Microsecond),
+	)
+}
@@ -1,19 +1,48 @@
 package main
 
 import (
+	"encoding/json"
 	"log"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "loadtest":
+			if err := RunLoadTest(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "import-html":
+			if err := RunImportHtml(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "schema":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(GetProtocolSchema()); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	err := NewMySqlStore()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	Blobs, err = NewLocalBlobStore("media")
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	Search = NewMemoryIndex()
+
 	server := NewApiServer(":3000")
-	server.Run()
+	if err := server.Run(); err != nil {
+		log.Fatal(err)
+	}
 }
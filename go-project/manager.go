@@ -2,8 +2,10 @@ package main
 
 import (
 	"errors"
+	"log"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -15,15 +17,20 @@ var (
 	websocketUpgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
+		// The subprotocol picks the encoding of the messages, see SupportedEncodings
+		Subprotocols: SupportedEncodings,
 	}
 )
 
 var (
-	ErrEventNotSupported = errors.New("this event type is not supported")
+	ErrEventNotSupported  = NewProtocolError(ErrorCodeUnsupportedEvent, "this event type is not supported")
+	ErrPlayerNotConnected = errors.New("player is not connected to this game")
 )
 
 type Manager struct {
 	clients ClientList
+	// games indexes the connected clients by the code of the game they are in
+	games map[string]ClientList
 
 	// Using a syncMutex here to be able to lcok state before editing clients
 	// Could also use Channels to block
@@ -33,23 +40,28 @@ type Manager struct {
 }
 
 func (m *Manager) ServeWS(w http.ResponseWriter, r *http.Request, gameCode string) {
-	// Begin by upgrading the HTTP request
-	conn, err := websocketUpgrader.Upgrade(w, r, nil)
-	if err != nil {
+	user, ok := r.Context().Value("user").(UserContext)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusInternalServerError)
 		return
 	}
 
-	userID, ok := r.Context().Value("userID").(uint)
-	if !ok {
-		http.Error(w, "userID not found in context", http.StatusInternalServerError)
+	// Begin by upgrading the HTTP request
+	conn, err := websocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
 		return
 	}
 
 	// Create New Client
-	client := NewClient(conn, userID, gameCode)
+	client := NewClient(conn, user.UserID, gameCode)
+	if conn.Subprotocol() != "" {
+		client.encoding = conn.Subprotocol()
+	}
 	// Add the newly created client to the manager
 	m.addClient(client)
 
+	HelloSend(client)
+
 	go client.readMessages()
 	go client.writeMessages()
 }
@@ -61,6 +73,11 @@ func (m *Manager) addClient(client *Client) {
 
 	// Add Client
 	m.clients[client] = true
+
+	if _, ok := m.games[client.gameCode]; !ok {
+		m.games[client.gameCode] = make(ClientList)
+	}
+	m.games[client.gameCode][client] = true
 }
 
 // removeClient will remove the client and clean up
@@ -70,14 +87,154 @@ func (m *Manager) removeClient(client *Client) {
 
 	// Check if Client exists, then delete it
 	if _, ok := m.clients[client]; ok {
-		// close connection
-		client.connection.Close()
+		// close connection, bots do not have one
+		if client.connection != nil {
+			client.connection.Close()
+		}
+		// closing egress stops the writer, sends only happen under the manager lock
+		close(client.egress)
 		// remove
 		delete(m.clients, client)
+
+		if gameClients, ok := m.games[client.gameCode]; ok {
+			delete(gameClients, client)
+			if len(gameClients) == 0 {
+				delete(m.games, client.gameCode)
+			}
+		}
+	}
+}
+
+// BroadcastToGame sends the message to every client connected to the game. Clients that
+// cannot keep up with their egress are disconnected instead of blocking the broadcast
+func (m *Manager) BroadcastToGame(gameCode string, message *OutgoingMessage) {
+	var slow []*Client
+
+	m.RLock()
+	for client := range m.games[gameCode] {
+		if !client.trySend(message) {
+			slow = append(slow, client)
+		}
+	}
+	m.RUnlock()
+
+	m.dropSlowClients(slow)
+}
+
+// Broadcast sends the message to every connected client
+func (m *Manager) Broadcast(message *OutgoingMessage) {
+	var slow []*Client
+
+	m.RLock()
+	for client := range m.clients {
+		if !client.trySend(message) {
+			slow = append(slow, client)
+		}
+	}
+	m.RUnlock()
+
+	m.dropSlowClients(slow)
+}
+
+// CloseAll sends a close frame to every client and disconnects it
+func (m *Manager) CloseAll() {
+	m.RLock()
+	clients := make([]*Client, 0, len(m.clients))
+	for client := range m.clients {
+		clients = append(clients, client)
+	}
+	m.RUnlock()
+
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown")
+	for _, client := range clients {
+		if client.connection == nil {
+			m.removeClient(client)
+			continue
+		}
+
+		if err := client.connection.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second)); err != nil {
+			log.Println("failed to send close message: ", err)
+		}
+		m.removeClient(client)
+	}
+}
+
+// SendToClient sends the message to a single connection, it reports false when the client
+// is no longer connected
+func (m *Manager) SendToClient(client *Client, message *OutgoingMessage) bool {
+	m.RLock()
+	_, ok := m.clients[client]
+	sent := ok && client.trySend(message)
+	m.RUnlock()
+
+	if ok && !sent {
+		m.dropSlowClients([]*Client{client})
+	}
+
+	return sent
+}
+
+// SendToPlayer sends the message to every connection the player has open in the game
+func (m *Manager) SendToPlayer(gameCode string, userId uint, message *OutgoingMessage) error {
+	var slow []*Client
+	found := false
+
+	m.RLock()
+	for client := range m.games[gameCode] {
+		if client.userId != userId {
+			continue
+		}
+
+		found = true
+		if !client.trySend(message) {
+			slow = append(slow, client)
+		}
+	}
+	m.RUnlock()
+
+	m.dropSlowClients(slow)
+
+	if !found {
+		return ErrPlayerNotConnected
+	}
+
+	return nil
+}
+
+// DisconnectPlayer closes every connection the player has open in the game
+func (m *Manager) DisconnectPlayer(gameCode string, userId uint) {
+	var clients []*Client
+
+	m.RLock()
+	for client := range m.games[gameCode] {
+		if client.userId == userId {
+			clients = append(clients, client)
+		}
+	}
+	m.RUnlock()
+
+	for _, client := range clients {
+		m.removeClient(client)
+	}
+}
+
+// GameClients returns the number of clients connected to the game
+func (m *Manager) GameClients(gameCode string) int {
+	m.RLock()
+	defer m.RUnlock()
+
+	return len(m.games[gameCode])
+}
+
+func (m *Manager) dropSlowClients(clients []*Client) {
+	for _, client := range clients {
+		log.Printf("dropping slow client %d in game %s", client.userId, client.gameCode)
+		m.removeClient(client)
 	}
 }
 
 func (m *Manager) setupEventHandlers() {
+	m.handlers[EventHello] = HelloHandler
 	m.handlers[EventSendAnswer] = SendAnswerHandler
 }
 
@@ -98,6 +255,7 @@ func (m *Manager) routeEvent(event Event, c *Client) error {
 func NewManager() *Manager {
 	m := &Manager{
 		clients:  make(ClientList),
+		games:    make(map[string]ClientList),
 		handlers: make(map[string]EventHandler),
 	}
 	m.setupEventHandlers()
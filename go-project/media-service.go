@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	MediaImage = "image"
+	MediaAudio = "audio"
+)
+
+const (
+	maxImageSize = 5 << 20
+	maxAudioSize = 10 << 20
+	// maxMediaSize is the largest upload of any kind, it bounds the multipart form
+	maxMediaSize   = maxAudioSize
+	mediaKeyLength = 16
+	mediaCacheAge  = 365 * 24 * time.Hour
+)
+
+// mediaTypes maps the content types sniffed from uploads to their kind and the type
+// they are served with
+var mediaTypes = map[string]struct {
+	kind        string
+	contentType string
+}{
+	"image/png":       {MediaImage, "image/png"},
+	"image/jpeg":      {MediaImage, "image/jpeg"},
+	"image/gif":       {MediaImage, "image/gif"},
+	"image/webp":      {MediaImage, "image/webp"},
+	"audio/mpeg":      {MediaAudio, "audio/mpeg"},
+	"audio/wave":      {MediaAudio, "audio/wav"},
+	"application/ogg": {MediaAudio, "audio/ogg"},
+}
+
+var (
+	ErrMediaType     = errors.New("only png, jpeg, gif and webp images and mp3, wav and ogg audio can be uploaded")
+	ErrMediaTooLarge = errors.New("media is too large")
+	ErrMediaNotFound = errors.New("media not found")
+)
+
+// UploadMedia stores an image or audio clip for the user. The type is sniffed from the
+// content, the name and type sent by the client are not trusted
+func UploadMedia(content io.Reader, userId uint) (*MediaDto, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	head = head[:n]
+
+	mediaType, ok := mediaTypes[http.DetectContentType(head)]
+	if !ok {
+		return nil, ErrMediaType
+	}
+
+	maxSize := int64(maxImageSize)
+	if mediaType.kind == MediaAudio {
+		maxSize = maxAudioSize
+	}
+
+	key, err := generateMediaKey()
+	if err != nil {
+		return nil, err
+	}
+
+	// One byte over the limit is read to tell a file at the limit from a larger one
+	size, err := Blobs.Put(key, io.LimitReader(io.MultiReader(bytes.NewReader(head), content), maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if size > maxSize {
+		Blobs.Delete(key)
+		return nil, fmt.Errorf("%w, %s can be at most %d MB", ErrMediaTooLarge, mediaType.kind, maxSize>>20)
+	}
+
+	media := Media{
+		Key:         key,
+		Kind:        mediaType.kind,
+		ContentType: mediaType.contentType,
+		Size:        size,
+		OwnerId:     userId,
+	}
+
+	if err := Db.PostMedia(&media); err != nil {
+		Blobs.Delete(key)
+		return nil, err
+	}
+
+	return CreateMediaDto(&media), nil
+}
+
+// OpenMedia returns the media with its content, keys are random so whoever knows one may
+// read the media. This lets players load media during games without extra checks
+func OpenMedia(key string) (*Media, io.ReadSeekCloser, error) {
+	media, err := Db.GetMediaByKey(key)
+	if err != nil {
+		return nil, nil, ErrMediaNotFound
+	}
+
+	content, err := Blobs.Open(media.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return media, content, nil
+}
+
+// copyMedia stores a copy of the media for another owner, the content is copied too so
+// the copy does not depend on the original
+func copyMedia(media *Media, ownerId uint) (*Media, error) {
+	content, err := Blobs.Open(media.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	key, err := generateMediaKey()
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := Blobs.Put(key, content)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := Media{
+		Key:         key,
+		Kind:        media.Kind,
+		ContentType: media.ContentType,
+		Size:        size,
+		OwnerId:     ownerId,
+	}
+
+	if err := Db.PostMedia(&copied); err != nil {
+		Blobs.Delete(key)
+		return nil, err
+	}
+
+	return &copied, nil
+}
+
+// validateQuizMedia checks that the media a quiz refers to exists and belongs to one of
+// its authors, err is only set when the media could not be looked up
+func validateQuizMedia(data *QuizData, authorIds []uint) (ValidationErrors, error) {
+	return validateQuestionMedia(data.Questions, authorIds, func(i int) string {
+		return fmt.Sprintf("questions[%d].", i)
+	})
+}
+
+// validateQuestionMedia checks the media of the questions, prefix returns what is put in
+// front of the field paths of question i
+func validateQuestionMedia(questions []QuestionData, authorIds []uint, prefix func(i int) string) (ValidationErrors, error) {
+	var ids []uint
+	for _, question := range questions {
+		if question.MediaId != nil {
+			ids = append(ids, *question.MediaId)
+		}
+		for _, answer := range question.Answers {
+			if answer.MediaId != nil {
+				ids = append(ids, *answer.MediaId)
+			}
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	media, err := Db.GetMediaByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := make(map[uint]bool, len(media))
+	for _, m := range media {
+		owned[m.Id] = isQuizAuthor(authorIds, m.OwnerId)
+	}
+
+	var errs ValidationErrors
+	check := func(path string, id *uint) {
+		if id != nil && !owned[*id] {
+			errs = append(errs, ValidationError{Field: path + "mediaId", Message: "media does not exist or belongs to another account"})
+		}
+	}
+
+	for i, question := range questions {
+		path := prefix(i)
+		check(path, question.MediaId)
+		for j, answer := range question.Answers {
+			check(fmt.Sprintf("%sanswers[%d].", path, j), answer.MediaId)
+		}
+	}
+
+	return errs, nil
+}
+
+func generateMediaKey() (string, error) {
+	key := make([]byte, mediaKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(key), nil
+}
+
+func CreateMediaDto(media *Media) *MediaDto {
+	if media == nil {
+		return nil
+	}
+
+	return &MediaDto{
+		Id:          media.Id,
+		Url:         "/media/" + media.Key,
+		Kind:        media.Kind,
+		ContentType: media.ContentType,
+		Size:        media.Size,
+	}
+}
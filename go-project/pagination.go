@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+var (
+	ErrInvalidCursor = errors.New("cursor is invalid")
+	ErrCursorMoved   = errors.New("cursor belongs to another sort, start again without it")
+)
+
+// PageRequest asks for one page of a list. Pages follow each other through the opaque
+// Cursor of the previous page, which stays valid when rows are added in the meantime
+type PageRequest struct {
+	Limit     int
+	Cursor    string
+	Sort      string
+	Direction string
+}
+
+// PageInfo tells how to get the next page, NextCursor is empty on the last one
+type PageInfo struct {
+	NextCursor string
+	Total      int64
+}
+
+// pageCursor is the position after the last row of a page, the sort value and the id
+// break ties between rows with the same value
+type pageCursor struct {
+	Sort      string      `json:"s"`
+	Direction string      `json:"d"`
+	Value     interface{} `json:"v,omitempty"`
+	Id        uint        `json:"i"`
+}
+
+// sortColumn is a column a list can be sorted by and how to read it from a row
+type sortColumn[T any] struct {
+	column string
+	value  func(item *T) interface{}
+}
+
+// pageSpec describes how a list is paged, Sorts always has an id entry that is the default
+type pageSpec[T any] struct {
+	sorts     map[string]sortColumn[T]
+	id        func(item *T) uint
+	direction string
+}
+
+// ParsePageRequest reads limit, cursor, sort and direction from the query of a request
+func ParsePageRequest(r *http.Request) (*PageRequest, error) {
+	query := r.URL.Query()
+	page := PageRequest{
+		Cursor:    query.Get("cursor"),
+		Sort:      query.Get("sort"),
+		Direction: query.Get("direction"),
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return nil, errors.New("limit must be a positive number")
+		}
+		page.Limit = limit
+	}
+
+	if page.Direction != "" && page.Direction != SortAsc && page.Direction != SortDesc {
+		return nil, errors.New("direction must be asc or desc")
+	}
+
+	return &page, nil
+}
+
+// WritePageHeaders sets the total count and a Link header with the first and the next page
+func WritePageHeaders(w http.ResponseWriter, r *http.Request, info *PageInfo) {
+	w.Header().Set("X-Total-Count", strconv.FormatInt(info.Total, 10))
+
+	link := func(cursor string, rel string) string {
+		query := r.URL.Query()
+		query.Del("cursor")
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		target := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		return fmt.Sprintf("<%s>; rel=\"%s\"", target.String(), rel)
+	}
+
+	links := link("", "first")
+	if info.NextCursor != "" {
+		links += ", " + link(info.NextCursor, "next")
+	}
+	w.Header().Set("Link", links)
+}
+
+// findPage loads one page of the rows matched by query. The total is counted before the
+// cursor is applied, preloads are only run for the rows of the page
+func findPage[T any](query *gorm.DB, page *PageRequest, spec pageSpec[T], preloads ...string) ([]T, *PageInfo, error) {
+	if page == nil {
+		page = &PageRequest{}
+	}
+
+	limit := pageLimit(page)
+	sortName := page.Sort
+	if sortName == "" {
+		sortName = "id"
+	}
+	sort, ok := spec.sorts[sortName]
+	if !ok {
+		return nil, nil, fmt.Errorf("list cannot be sorted by %s", sortName)
+	}
+
+	direction := page.Direction
+	if direction == "" {
+		direction = spec.direction
+	}
+	if direction == "" {
+		direction = SortAsc
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Model(new(T)).Count(&total).Error; err != nil {
+		return nil, nil, err
+	}
+
+	query = query.Session(&gorm.Session{})
+	if page.Cursor != "" {
+		cursor, err := decodeCursor(page.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cursor.Sort != sortName || cursor.Direction != direction {
+			return nil, nil, ErrCursorMoved
+		}
+
+		op := ">"
+		if direction == SortDesc {
+			op = "<"
+		}
+
+		if sort.column == "id" {
+			query = query.Where(fmt.Sprintf("id %s ?", op), cursor.Id)
+		} else {
+			query = query.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", sort.column, op, sort.column, op),
+				cursor.Value, cursor.Value, cursor.Id)
+		}
+	}
+
+	if sort.column != "id" {
+		query = query.Order(sort.column + " " + direction)
+	}
+	query = query.Order("id " + direction)
+
+	for _, preload := range preloads {
+		query = query.Preload(preload)
+	}
+
+	// One row more than asked for tells whether there is a next page
+	var items []T
+	if err := query.Limit(limit + 1).Find(&items).Error; err != nil {
+		return nil, nil, err
+	}
+
+	info := PageInfo{Total: total}
+	if len(items) > limit {
+		items = items[:limit]
+
+		last := &items[len(items)-1]
+		cursor := pageCursor{Sort: sortName, Direction: direction, Id: spec.id(last)}
+		if sort.column != "id" {
+			cursor.Value = sort.value(last)
+		}
+		info.NextCursor = encodeCursor(cursor)
+	}
+
+	return items, &info, nil
+}
+
+// pageLimit is the number of rows of the page, the default when none was asked for
+func pageLimit(page *PageRequest) int {
+	if page.Limit <= 0 {
+		return defaultPageLimit
+	} else if page.Limit > maxPageLimit {
+		return maxPageLimit
+	}
+
+	return page.Limit
+}
+
+// timeCursor writes a time the way MySQL compares it with a datetime column
+func timeCursor(t time.Time) interface{} {
+	return t.In(time.Local).Format("2006-01-02 15:04:05.999999")
+}
+
+// priceCursor writes a price the way priceSortColumn reads it, MySQL rounds half away from
+// zero like math.Round
+func priceCursor(price float32) interface{} {
+	return strconv.FormatFloat(math.Round(float64(price)*100)/100, 'f', 2, 64)
+}
+
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
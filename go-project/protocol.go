@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// ProtocolVersion is the version of the websocket protocol spoken by this server. It is
+// announced in the hello event and bumped on every breaking change to the events
+const ProtocolVersion = 1
+
+// SupportedProtocolVersions are the versions a client may ask for in its hello
+var SupportedProtocolVersions = []int{1}
+
+// Machine readable codes sent in error events
+const (
+	ErrorCodeBadRequest         = "bad_request"
+	ErrorCodeUnsupportedEvent   = "unsupported_event"
+	ErrorCodeUnsupportedVersion = "unsupported_version"
+	ErrorCodeInvalidAnswer      = "invalid_answer"
+	ErrorCodeGameNotRunning     = "game_not_running"
+	ErrorCodeQuestionNotActive  = "question_not_active"
+	ErrorCodeAnswerTooLate      = "answer_too_late"
+	ErrorCodeAlreadyAnswered    = "already_answered"
+	ErrorCodeInternal           = "internal_error"
+)
+
+// protocolErrorCodes lists every error code for the schema
+var protocolErrorCodes = []string{
+	ErrorCodeBadRequest,
+	ErrorCodeUnsupportedEvent,
+	ErrorCodeUnsupportedVersion,
+	ErrorCodeInvalidAnswer,
+	ErrorCodeGameNotRunning,
+	ErrorCodeQuestionNotActive,
+	ErrorCodeAnswerTooLate,
+	ErrorCodeAlreadyAnswered,
+	ErrorCodeInternal,
+}
+
+// ProtocolError is returned by event handlers to reject an event with a code the client
+// can act on
+type ProtocolError struct {
+	Code    string
+	Message string
+}
+
+func (e *ProtocolError) Error() string {
+	return e.Message
+}
+
+func NewProtocolError(code string, message string) *ProtocolError {
+	return &ProtocolError{Code: code, Message: message}
+}
+
+// toErrorEvent turns any handler error into the payload of an error event
+func toErrorEvent(requestId string, err error) ErrorEvent {
+	var protocolErr *ProtocolError
+	if errors.As(err, &protocolErr) {
+		return ErrorEvent{RequestId: requestId, Code: protocolErr.Code, Message: protocolErr.Message}
+	}
+
+	return ErrorEvent{RequestId: requestId, Code: ErrorCodeInternal, Message: err.Error()}
+}
+
+const (
+	DirectionClient = "client"
+	DirectionServer = "server"
+)
+
+// ProtocolEvent describes a single event type of the protocol
+type ProtocolEvent struct {
+	Type      string      `json:"type"`
+	Direction string      `json:"direction"`
+	Payload   interface{} `json:"-"`
+}
+
+// protocolEvents lists every event of the protocol, new events have to be added here so
+// they show up in the schema
+var protocolEvents = []ProtocolEvent{
+	{Type: EventHello, Direction: DirectionClient, Payload: HelloEvent{}},
+	{Type: EventSendAnswer, Direction: DirectionClient, Payload: SendAnswerEvent{}},
+	{Type: EventHello, Direction: DirectionServer, Payload: HelloEvent{}},
+	{Type: EventAck, Direction: DirectionServer, Payload: AckEvent{}},
+	{Type: EventError, Direction: DirectionServer, Payload: ErrorEvent{}},
+	{Type: EventNextRound, Direction: DirectionServer, Payload: NextRoundEvent{}},
+	{Type: EventGameOver, Direction: DirectionServer, Payload: GameOverEvent{}},
+	{Type: EventServerShutdown, Direction: DirectionServer, Payload: ServerShutdownEvent{}},
+}
+
+// ProtocolSchema is a JSON schema like description of all events, meant for generating
+// client bindings
+type ProtocolSchema struct {
+	ProtocolVersion   int                   `json:"protocolVersion"`
+	SupportedVersions []int                 `json:"supportedVersions"`
+	Encodings         []string              `json:"encodings"`
+	Envelope          JsonSchema            `json:"envelope"`
+	ErrorCodes        []string              `json:"errorCodes"`
+	Events            []ProtocolEventSchema `json:"events"`
+}
+
+type ProtocolEventSchema struct {
+	Type      string     `json:"type"`
+	Direction string     `json:"direction"`
+	Payload   JsonSchema `json:"payload"`
+}
+
+// JsonSchema is the subset of JSON schema needed to describe the event payloads
+type JsonSchema struct {
+	Type       string                 `json:"type,omitempty"`
+	Properties map[string]*JsonSchema `json:"properties,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+	Items      *JsonSchema            `json:"items,omitempty"`
+	Nullable   bool                   `json:"nullable,omitempty"`
+}
+
+func GetProtocolSchema() ProtocolSchema {
+	events := make([]ProtocolEventSchema, 0, len(protocolEvents))
+	for _, event := range protocolEvents {
+		events = append(events, ProtocolEventSchema{
+			Type:      event.Type,
+			Direction: event.Direction,
+			Payload:   *schemaOf(reflect.TypeOf(event.Payload)),
+		})
+	}
+
+	return ProtocolSchema{
+		ProtocolVersion:   ProtocolVersion,
+		SupportedVersions: SupportedProtocolVersions,
+		Encodings:         SupportedEncodings,
+		Envelope:          *schemaOf(reflect.TypeOf(Event{})),
+		ErrorCodes:        protocolErrorCodes,
+		Events:            events,
+	}
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// schemaOf builds the schema of a go type following its json tags
+func schemaOf(t reflect.Type) *JsonSchema {
+	if t == rawMessageType {
+		return &JsonSchema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := schemaOf(t.Elem())
+		schema.Nullable = true
+		return schema
+	case reflect.Bool:
+		return &JsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JsonSchema{Type: "number"}
+	case reflect.String:
+		return &JsonSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &JsonSchema{Type: "array", Items: schemaOf(t.Elem())}
+	case reflect.Map:
+		return &JsonSchema{Type: "object"}
+	case reflect.Struct:
+		schema := &JsonSchema{Type: "object", Properties: make(map[string]*JsonSchema)}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			} else if name == "" {
+				name = field.Name
+			}
+
+			schema.Properties[name] = schemaOf(field.Type)
+			if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Pointer {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		return schema
+	}
+
+	return &JsonSchema{}
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// QTI 2.1 packages are zips with an imsmanifest.xml, one assessmentItem per question and
+// an assessmentTest holding the order of the questions. Points are kept in the mapping of
+// every item and the question time in the timeLimits of the item reference in the test
+const (
+	qtiManifestFile     = "imsmanifest.xml"
+	qtiTestFile         = "test.xml"
+	qtiNamespace        = "http://www.imsglobal.org/xsd/imsqti_v2p1"
+	qtiManifestNs       = "http://www.imsglobal.org/xsd/imscp_v1p1"
+	qtiLomNs            = "http://ltsc.ieee.org/xsd/LOM"
+	qtiItemType         = "imsqti_item_xmlv2p1"
+	qtiTestType         = "imsqti_test_xmlv2p1"
+	qtiResponseId       = "RESPONSE"
+	qtiMapResponse      = "http://www.imsglobal.org/question/qti_v2p1/rptemplates/map_response"
+	qtiMaxPackageFiles  = 1000
+	qtiMaxFileSize      = 1 << 20
+	qtiMaxUnpackedSize  = 16 << 20
+	qtiChoicePrefix     = "choice"
+	qtiItemPrefix       = "item"
+	qtiIdentifierPrefix = "quizzland"
+)
+
+var errQtiFileTooLarge = fmt.Errorf("file is larger than %d bytes unpacked", qtiMaxFileSize)
+
+type qtiManifest struct {
+	XMLName    xml.Name      `xml:"manifest"`
+	Xmlns      string        `xml:"xmlns,attr,omitempty"`
+	Identifier string        `xml:"identifier,attr"`
+	Metadata   *qtiMetadata  `xml:"metadata"`
+	Resources  []qtiResource `xml:"resources>resource"`
+}
+
+type qtiMetadata struct {
+	Schema        string  `xml:"schema"`
+	SchemaVersion string  `xml:"schemaversion"`
+	Lom           *qtiLom `xml:"lom"`
+}
+
+type qtiLom struct {
+	Xmlns       string `xml:"xmlns,attr,omitempty"`
+	Title       string `xml:"general>title>string"`
+	Description string `xml:"general>description>string"`
+}
+
+type qtiResource struct {
+	Identifier   string          `xml:"identifier,attr"`
+	Type         string          `xml:"type,attr"`
+	Href         string          `xml:"href,attr"`
+	Files        []qtiFile       `xml:"file"`
+	Dependencies []qtiDependency `xml:"dependency"`
+}
+
+type qtiFile struct {
+	Href string `xml:"href,attr"`
+}
+
+type qtiDependency struct {
+	IdentifierRef string `xml:"identifierref,attr"`
+}
+
+type qtiItem struct {
+	XMLName             xml.Name               `xml:"assessmentItem"`
+	Xmlns               string                 `xml:"xmlns,attr,omitempty"`
+	Identifier          string                 `xml:"identifier,attr"`
+	Title               string                 `xml:"title,attr"`
+	Adaptive            bool                   `xml:"adaptive,attr"`
+	TimeDependent       bool                   `xml:"timeDependent,attr"`
+	ResponseDeclaration qtiResponseDeclaration `xml:"responseDeclaration"`
+	OutcomeDeclaration  qtiOutcomeDeclaration  `xml:"outcomeDeclaration"`
+	ItemBody            qtiItemBody            `xml:"itemBody"`
+	ResponseProcessing  qtiResponseProcessing  `xml:"responseProcessing"`
+}
+
+type qtiResponseDeclaration struct {
+	Identifier      string      `xml:"identifier,attr"`
+	Cardinality     string      `xml:"cardinality,attr"`
+	BaseType        string      `xml:"baseType,attr"`
+	CorrectResponse []string    `xml:"correctResponse>value"`
+	Mapping         *qtiMapping `xml:"mapping"`
+}
+
+type qtiMapping struct {
+	DefaultValue float64       `xml:"defaultValue,attr"`
+	Entries      []qtiMapEntry `xml:"mapEntry"`
+}
+
+type qtiMapEntry struct {
+	MapKey      string  `xml:"mapKey,attr"`
+	MappedValue float64 `xml:"mappedValue,attr"`
+}
+
+type qtiOutcomeDeclaration struct {
+	Identifier  string `xml:"identifier,attr"`
+	Cardinality string `xml:"cardinality,attr"`
+	BaseType    string `xml:"baseType,attr"`
+}
+
+type qtiItemBody struct {
+	ChoiceInteraction *qtiChoiceInteraction `xml:"choiceInteraction"`
+}
+
+type qtiChoiceInteraction struct {
+	ResponseIdentifier string            `xml:"responseIdentifier,attr"`
+	Shuffle            bool              `xml:"shuffle,attr"`
+	MaxChoices         int               `xml:"maxChoices,attr"`
+	Prompt             qtiText           `xml:"prompt"`
+	Choices            []qtiSimpleChoice `xml:"simpleChoice"`
+}
+
+type qtiSimpleChoice struct {
+	Identifier string `xml:"identifier,attr"`
+	Inner      string `xml:",innerxml"`
+}
+
+// qtiText is an element that may hold XHTML markup, only its text is kept on import
+type qtiText struct {
+	Inner string `xml:",innerxml"`
+}
+
+type qtiResponseProcessing struct {
+	Template string `xml:"template,attr"`
+}
+
+type qtiTest struct {
+	XMLName    xml.Name      `xml:"assessmentTest"`
+	Xmlns      string        `xml:"xmlns,attr,omitempty"`
+	Identifier string        `xml:"identifier,attr"`
+	Title      string        `xml:"title,attr"`
+	TestParts  []qtiTestPart `xml:"testPart"`
+}
+
+type qtiTestPart struct {
+	Identifier     string       `xml:"identifier,attr"`
+	NavigationMode string       `xml:"navigationMode,attr"`
+	SubmissionMode string       `xml:"submissionMode,attr"`
+	Sections       []qtiSection `xml:"assessmentSection"`
+}
+
+type qtiSection struct {
+	Identifier string       `xml:"identifier,attr"`
+	Title      string       `xml:"title,attr"`
+	Visible    bool         `xml:"visible,attr"`
+	ItemRefs   []qtiItemRef `xml:"assessmentItemRef"`
+}
+
+type qtiItemRef struct {
+	Identifier string         `xml:"identifier,attr"`
+	Href       string         `xml:"href,attr"`
+	TimeLimits *qtiTimeLimits `xml:"timeLimits"`
+}
+
+type qtiTimeLimits struct {
+	MaxTime float64 `xml:"maxTime,attr"`
+}
+
+func parseQuizQti(document io.Reader) (*QuizData, error) {
+	content, err := io.ReadAll(document)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, ValidationErrors{{Message: "package is not a zip file"}}
+	} else if len(archive.File) > qtiMaxPackageFiles {
+		return nil, ValidationErrors{{Message: "package has too many files"}}
+	}
+
+	// Files are read against a budget of unpacked bytes, a file that is referred to again
+	// is paid for again
+	budget := int64(qtiMaxUnpackedSize)
+
+	var manifest qtiManifest
+	if err := readQtiFile(archive, qtiManifestFile, &manifest, &budget); err != nil {
+		return nil, err
+	}
+
+	var data QuizData
+	if manifest.Metadata != nil && manifest.Metadata.Lom != nil {
+		data.Name = manifest.Metadata.Lom.Title
+		data.Description = manifest.Metadata.Lom.Description
+	}
+
+	// The test decides the order and the time of the questions, without one every item
+	// of the manifest is a question in the order it is listed
+	var refs []qtiItemRef
+	for _, resource := range manifest.Resources {
+		if resource.Type != qtiTestType {
+			continue
+		}
+
+		var test qtiTest
+		if err := readQtiFile(archive, resource.Href, &test, &budget); err != nil {
+			return nil, err
+		}
+
+		if data.Name == "" {
+			data.Name = test.Title
+		}
+		for _, part := range test.TestParts {
+			for _, section := range part.Sections {
+				for _, ref := range section.ItemRefs {
+					ref.Href = path.Join(path.Dir(resource.Href), ref.Href)
+					refs = append(refs, ref)
+				}
+			}
+		}
+		break
+	}
+
+	if refs == nil {
+		for _, resource := range manifest.Resources {
+			if strings.HasPrefix(resource.Type, "imsqti_item_") {
+				refs = append(refs, qtiItemRef{Identifier: resource.Identifier, Href: resource.Href})
+			}
+		}
+	}
+
+	var errs ValidationErrors
+	for _, ref := range refs {
+		var item qtiItem
+		if err := readQtiFile(archive, ref.Href, &item, &budget); err != nil {
+			return nil, err
+		}
+
+		question, err := qtiItemToQuestion(&item)
+		if err != nil {
+			errs = append(errs, ValidationError{Field: ref.Href, Message: err.Error()})
+			continue
+		}
+
+		question.Time = defaultImportTime
+		if ref.TimeLimits != nil && ref.TimeLimits.MaxTime > 0 {
+			question.Time = uint(ref.TimeLimits.MaxTime)
+		}
+
+		data.Questions = append(data.Questions, *question)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return &data, nil
+}
+
+// readQtiFile decodes the file of the package and takes its unpacked size from the budget
+func readQtiFile(archive *zip.Reader, name string, v interface{}, budget *int64) error {
+	file, err := archive.Open(name)
+	if err != nil {
+		return ValidationErrors{{Field: name, Message: "file is missing from the package"}}
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return ValidationErrors{{Field: name, Message: err.Error()}}
+	}
+
+	if info.Size() > qtiMaxFileSize {
+		return ValidationErrors{{Field: name, Message: errQtiFileTooLarge.Error()}}
+	} else if info.Size() > *budget {
+		return ValidationErrors{{Field: name, Message: "package is too large once unpacked"}}
+	}
+
+	// The declared size is not trusted, reading stops once the limit is passed
+	limit := min(int64(qtiMaxFileSize), *budget)
+	reader := &qtiLimitedReader{r: file, remaining: limit + 1}
+	defer func() {
+		*budget -= limit + 1 - reader.remaining
+	}()
+
+	if err := xml.NewDecoder(reader).Decode(v); err != nil {
+		if errors.Is(err, errQtiFileTooLarge) && limit < qtiMaxFileSize {
+			return ValidationErrors{{Field: name, Message: "package is too large once unpacked"}}
+		} else if errors.Is(err, errQtiFileTooLarge) {
+			return ValidationErrors{{Field: name, Message: err.Error()}}
+		}
+
+		var syntaxErr *xml.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return ValidationErrors{{Line: syntaxErr.Line, Field: name, Message: syntaxErr.Msg}}
+		}
+		return ValidationErrors{{Field: name, Message: err.Error()}}
+	}
+
+	return nil
+}
+
+// qtiLimitedReader fails once more than the remaining bytes were read
+type qtiLimitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *qtiLimitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, errQtiFileTooLarge
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if err == nil && l.remaining <= 0 {
+		err = errQtiFileTooLarge
+	}
+	return n, err
+}
+
+func qtiItemToQuestion(item *qtiItem) (*QuestionData, error) {
+	interaction := item.ItemBody.ChoiceInteraction
+	if interaction == nil {
+		return nil, fmt.Errorf("item %q is not a choice interaction, which is the only supported type", item.Identifier)
+	}
+
+	question := QuestionData{Text: qtiPlainText(interaction.Prompt.Inner)}
+	if question.Text == "" {
+		question.Text = item.Title
+	}
+
+	correct := make(map[string]bool)
+	for _, value := range item.ResponseDeclaration.CorrectResponse {
+		correct[strings.TrimSpace(value)] = true
+	}
+
+	points := make(map[string]float64)
+	if item.ResponseDeclaration.Mapping != nil {
+		for _, entry := range item.ResponseDeclaration.Mapping.Entries {
+			points[entry.MapKey] = entry.MappedValue
+		}
+	}
+
+	for _, choice := range interaction.Choices {
+		answer := AnswerData{
+			Text:    qtiPlainText(choice.Inner),
+			IsRight: correct[choice.Identifier],
+		}
+
+		if value, ok := points[choice.Identifier]; ok && value > 0 {
+			answer.Points = uint(value)
+			answer.IsRight = true
+		} else if answer.IsRight {
+			answer.Points = defaultImportPoints
+		}
+
+		question.Answers = append(question.Answers, answer)
+	}
+
+	return &question, nil
+}
+
+// qtiPlainText drops the XHTML markup QTI allows in prompts and choices
+func qtiPlainText(inner string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(inner))
+	if err != nil {
+		return strings.TrimSpace(inner)
+	}
+
+	return strings.Join(strings.Fields(doc.Text()), " ")
+}
+
+func formatQuizQti(data *QuizData) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	manifest := qtiManifest{
+		Xmlns:      qtiManifestNs,
+		Identifier: qtiIdentifierPrefix + "-manifest",
+		Metadata: &qtiMetadata{
+			Schema:        "QTIv2.1 Package",
+			SchemaVersion: "1.0.0",
+			Lom: &qtiLom{
+				Xmlns:       qtiLomNs,
+				Title:       data.Name,
+				Description: data.Description,
+			},
+		},
+	}
+
+	test := qtiTest{
+		Xmlns:      qtiNamespace,
+		Identifier: qtiIdentifierPrefix + "-test",
+		Title:      data.Name,
+	}
+	section := qtiSection{Identifier: "section-1", Title: data.Name, Visible: true}
+	testResource := qtiResource{
+		Identifier: "test",
+		Type:       qtiTestType,
+		Href:       qtiTestFile,
+		Files:      []qtiFile{{Href: qtiTestFile}},
+	}
+
+	for i, question := range data.Questions {
+		identifier := fmt.Sprintf("%s-%d", qtiItemPrefix, i+1)
+		href := identifier + ".xml"
+
+		if err := writeQtiFile(archive, href, qtiItemFromQuestion(identifier, &question)); err != nil {
+			return nil, err
+		}
+
+		manifest.Resources = append(manifest.Resources, qtiResource{
+			Identifier: identifier,
+			Type:       qtiItemType,
+			Href:       href,
+			Files:      []qtiFile{{Href: href}},
+		})
+		testResource.Dependencies = append(testResource.Dependencies, qtiDependency{IdentifierRef: identifier})
+		section.ItemRefs = append(section.ItemRefs, qtiItemRef{
+			Identifier: identifier,
+			Href:       href,
+			TimeLimits: &qtiTimeLimits{MaxTime: float64(question.Time)},
+		})
+	}
+
+	test.TestParts = []qtiTestPart{{
+		Identifier:     "part-1",
+		NavigationMode: "linear",
+		SubmissionMode: "individual",
+		Sections:       []qtiSection{section},
+	}}
+	manifest.Resources = append([]qtiResource{testResource}, manifest.Resources...)
+
+	if err := writeQtiFile(archive, qtiTestFile, test); err != nil {
+		return nil, err
+	}
+	if err := writeQtiFile(archive, qtiManifestFile, manifest); err != nil {
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func qtiItemFromQuestion(identifier string, question *QuestionData) qtiItem {
+	interaction := qtiChoiceInteraction{
+		ResponseIdentifier: qtiResponseId,
+		Prompt:             qtiText{Inner: xmlEscape(question.Text)},
+	}
+	mapping := qtiMapping{}
+
+	var correct []string
+	for i, answer := range question.Answers {
+		choice := fmt.Sprintf("%s-%d", qtiChoicePrefix, i+1)
+		interaction.Choices = append(interaction.Choices, qtiSimpleChoice{
+			Identifier: choice,
+			Inner:      xmlEscape(answer.Text),
+		})
+
+		if answer.IsRight {
+			correct = append(correct, choice)
+			mapping.Entries = append(mapping.Entries, qtiMapEntry{MapKey: choice, MappedValue: float64(answer.Points)})
+		}
+	}
+
+	cardinality := "single"
+	interaction.MaxChoices = 1
+	if len(correct) > 1 {
+		cardinality = "multiple"
+		interaction.MaxChoices = 0
+	}
+
+	return qtiItem{
+		Xmlns:      qtiNamespace,
+		Identifier: identifier,
+		Title:      question.Text,
+		ResponseDeclaration: qtiResponseDeclaration{
+			Identifier:      qtiResponseId,
+			Cardinality:     cardinality,
+			BaseType:        "identifier",
+			CorrectResponse: correct,
+			Mapping:         &mapping,
+		},
+		OutcomeDeclaration: qtiOutcomeDeclaration{
+			Identifier:  "SCORE",
+			Cardinality: "single",
+			BaseType:    "float",
+		},
+		ItemBody:           qtiItemBody{ChoiceInteraction: &interaction},
+		ResponseProcessing: qtiResponseProcessing{Template: qtiMapResponse},
+	}
+}
+
+func writeQtiFile(archive *zip.Writer, name string, v interface{}) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(file, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(file)
+	encoder.Indent("", "  ")
+	return encoder.Encode(v)
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
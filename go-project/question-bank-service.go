@@ -0,0 +1,399 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Ways bank questions are added to a quiz. Referenced questions follow later changes of
+// the bank question, copies are independent of it
+const (
+	ComposeReference = "reference"
+	ComposeCopy      = "copy"
+)
+
+const (
+	randomQuizName     = "Random quiz"
+	maxRandomQuestions = 50
+)
+
+var ErrBankQuestionNotOwned = errors.New("question is not in your question bank")
+
+func GetBankQuestions(userId uint, filter *BankFilter, page *PageRequest) ([]BankQuestionDto, *PageInfo, error) {
+	filter.Tags = normalizeTags(filter.Tags)
+	questions, info, err := Db.GetBankQuestions(userId, filter, page)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	questionsDto := make([]BankQuestionDto, 0, len(questions))
+	for _, question := range questions {
+		questionsDto = append(questionsDto, *CreateBankQuestionDto(&question))
+	}
+
+	return questionsDto, info, nil
+}
+
+func GetBankQuestion(id uint, userId uint) (*BankQuestionDto, error) {
+	question, err := getOwnBankQuestion(id, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return CreateBankQuestionDto(question), nil
+}
+
+// CreateBankQuestion stores a question in the bank of the account, it fails with
+// ValidationErrors when the question is not valid
+func CreateBankQuestion(body *BankQuestionRequest, userId uint) (*BankQuestionDto, error) {
+	question := BankQuestion{OwnerId: userId}
+	if err := applyBankQuestionRequest(&question, body); err != nil {
+		return nil, err
+	}
+
+	if err := Db.PostBankQuestion(&question); err != nil {
+		return nil, err
+	}
+
+	return CreateBankQuestionDto(&question), nil
+}
+
+// ModifyBankQuestion changes the question, quizzes that refer to it follow the change
+func ModifyBankQuestion(id uint, body *BankQuestionRequest, userId uint) (*BankQuestionDto, error) {
+	question, err := getOwnBankQuestion(id, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyBankQuestionRequest(question, body); err != nil {
+		return nil, err
+	}
+
+	if err := Db.PutBankQuestion(question); err != nil {
+		return nil, err
+	}
+
+	return CreateBankQuestionDto(question), nil
+}
+
+func DeleteBankQuestion(id uint, userId uint) error {
+	question, err := getOwnBankQuestion(id, userId)
+	if err != nil {
+		return err
+	}
+
+	if err := Db.DeleteBankQuestionById(question.Id); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddBankQuestionsToQuiz appends the bank questions to the working copy of the quiz, by
+// reference or as copies
+func AddBankQuestionsToQuiz(quizId uint, body *ComposeQuizRequest, userId uint, role string) error {
+	switch body.Mode {
+	case "":
+		body.Mode = ComposeReference
+	case ComposeReference, ComposeCopy:
+	default:
+		return errors.New("mode must be reference or copy")
+	}
+
+	if len(body.QuestionIds) == 0 {
+		return errors.New("no questions were given")
+	}
+
+	quiz, err := Db.GetQuizWithQuestions(quizId)
+	if err != nil {
+		return err
+	}
+
+	if !canEditQuiz(quiz, userId, role) {
+		return errors.New("you do not have permission to modify this resource")
+	}
+
+	if !isQuizEditable(quiz) {
+		return ErrQuizLocked
+	}
+
+	questions, err := getBankQuestionsInOrder(body.QuestionIds, userId)
+	if err != nil {
+		return err
+	}
+
+	before := QuizDataFromQuiz(quiz)
+	for _, question := range questions {
+		quiz.Questions = append(quiz.Questions, questionFromBank(&question, body.Mode == ComposeReference))
+	}
+	quiz.Questions = copyQuestions(quiz.Questions, quiz.Id)
+
+	if errs, err := validateQuiz(quiz); err != nil {
+		return err
+	} else if len(errs) > 0 {
+		return errs
+	}
+
+	if err := Db.PutQuizWithQuestions(quiz); err != nil {
+		return err
+	}
+
+	recordQuizChanges(quiz.Id, userId, diffQuizData(before, QuizDataFromQuiz(quiz)))
+	reindexQuiz(quiz.Id)
+	return nil
+}
+
+// resolveBankQuestions fills the questions that refer to the bank with the content of the
+// bank question, so a quiz can never differ from the questions it refers to. Only the
+// banks of the authors can be referred to
+func resolveBankQuestions(questions []Question, authorIds []uint) (ValidationErrors, error) {
+	var ids []uint
+	for _, question := range questions {
+		if question.BankQuestionId != nil {
+			ids = append(ids, *question.BankQuestionId)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	found, err := Db.GetBankQuestionsByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	bank := make(map[uint]*BankQuestion, len(found))
+	for i := range found {
+		if isQuizAuthor(authorIds, found[i].OwnerId) {
+			bank[found[i].Id] = &found[i]
+		}
+	}
+
+	var errs ValidationErrors
+	for i := range questions {
+		if questions[i].BankQuestionId == nil {
+			continue
+		}
+
+		question, ok := bank[*questions[i].BankQuestionId]
+		if !ok {
+			errs = append(errs, ValidationError{Field: fmt.Sprintf("questions[%d].bankQuestionId", i), Message: ErrBankQuestionNotOwned.Error()})
+			continue
+		}
+
+		questions[i] = questionFromBank(question, true)
+	}
+
+	return errs, nil
+}
+
+// CreateRandomGame draws questions from the bank of the creator that match the tags and
+// the difficulty and starts a game with them. The questions are kept in a generated quiz
+// so the game is played like any other
+func CreateRandomGame(userId uint, body *CreateRandomGameRequest) (string, error) {
+	if !runner.IsAccepting() {
+		return "", ErrServerShuttingDown
+	}
+
+	if body.Count == 0 || body.Count > maxRandomQuestions {
+		return "", fmt.Errorf("count must be between 1 and %d", maxRandomQuestions)
+	}
+
+	acc, err := Db.GetAccountById(userId)
+	if err != nil {
+		return "", err
+	}
+
+	if acc.IsInGame {
+		return "", errors.New("cannot create a game user is already in an active one")
+	}
+
+	filter := BankFilter{Tags: normalizeTags(body.Tags), Difficulty: body.Difficulty}
+	ids, err := Db.GetBankQuestionIds(acc.Id, &filter)
+	if err != nil {
+		return "", err
+	}
+
+	if len(ids) < int(body.Count) {
+		return "", fmt.Errorf("question bank has only %d matching questions", len(ids))
+	}
+
+	seed := time.Now().UnixNano()
+	if body.Seed != nil {
+		seed = *body.Seed
+	}
+
+	random := rand.New(rand.NewSource(seed))
+	drawn := make([]uint, 0, body.Count)
+	for _, i := range random.Perm(len(ids))[:body.Count] {
+		drawn = append(drawn, ids[i])
+	}
+
+	questions, err := getBankQuestionsInOrder(drawn, acc.Id)
+	if err != nil {
+		return "", err
+	}
+
+	quiz := Quiz{
+		Name:       randomQuizName,
+		OwnerId:    acc.Id,
+		Owner:      *acc,
+		Status:     QuizGenerated,
+		Difficulty: body.Difficulty,
+	}
+	for _, question := range questions {
+		quiz.Questions = append(quiz.Questions, questionFromBank(&question, false))
+	}
+
+	if err := Db.PostQuiz(&quiz); err != nil {
+		return "", err
+	}
+
+	revision, err := publishRevision(&quiz)
+	if err != nil {
+		return "", err
+	}
+
+	return startGame(acc, &quiz, revision, &CreateGameRequest{
+		QuizId:      quiz.Id,
+		NumericCode: body.NumericCode,
+		AnswerOrder: body.AnswerOrder,
+		Seed:        &seed,
+	})
+}
+
+func getOwnBankQuestion(id uint, userId uint) (*BankQuestion, error) {
+	question, err := Db.GetBankQuestionById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if question.OwnerId != userId {
+		return nil, ErrBankQuestionNotOwned
+	}
+
+	return question, nil
+}
+
+// getBankQuestionsInOrder loads the bank questions of the owner in the order of the ids
+func getBankQuestionsInOrder(ids []uint, ownerId uint) ([]BankQuestion, error) {
+	found, err := Db.GetBankQuestionsByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byId := make(map[uint]BankQuestion, len(found))
+	for _, question := range found {
+		byId[question.Id] = question
+	}
+
+	questions := make([]BankQuestion, 0, len(ids))
+	for _, id := range ids {
+		question, ok := byId[id]
+		if !ok || question.OwnerId != ownerId {
+			return nil, fmt.Errorf("question %d is not in your question bank", id)
+		}
+		questions = append(questions, question)
+	}
+
+	return questions, nil
+}
+
+// applyBankQuestionRequest validates the request and sets it on the question
+func applyBankQuestionRequest(question *BankQuestion, body *BankQuestionRequest) error {
+	mediaErrs, err := validateQuestionMedia([]QuestionData{body.QuestionData}, []uint{question.OwnerId}, func(int) string { return "" })
+	if err != nil {
+		return err
+	}
+
+	errs := ValidateQuestionData(&body.QuestionData)
+	errs = append(errs, mediaErrs...)
+	errs = append(errs, validateQuizMetadata(&QuizMetadata{Tags: body.Tags, Difficulty: body.Difficulty})...)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	tags, err := Db.GetOrCreateTags(normalizeTags(body.Tags))
+	if err != nil {
+		return err
+	}
+
+	answers := make([]BankAnswer, 0, len(body.Answers))
+	for _, answer := range body.Answers {
+		answers = append(answers, BankAnswer{
+			Text:         answer.Text,
+			IsRight:      answer.IsRight,
+			Points:       answer.Points,
+			MediaId:      answer.MediaId,
+			Translations: answer.Translations,
+		})
+	}
+
+	question.Text = body.Text
+	question.Time = body.Time
+	question.MediaId = body.MediaId
+	question.Translations = body.Translations
+	question.Answers = answers
+	question.Tags = tags
+	question.Difficulty = body.Difficulty
+	return nil
+}
+
+// questionFromBank turns a bank question into a quiz question, linked questions keep
+// following the bank question
+func questionFromBank(question *BankQuestion, linked bool) Question {
+	answers := make([]Answer, 0, len(question.Answers))
+	for _, answer := range question.Answers {
+		answers = append(answers, Answer{
+			Text:         answer.Text,
+			IsRight:      answer.IsRight,
+			Points:       answer.Points,
+			MediaId:      answer.MediaId,
+			Translations: answer.Translations,
+		})
+	}
+
+	result := Question{
+		Text:         question.Text,
+		Time:         question.Time,
+		MediaId:      question.MediaId,
+		Translations: question.Translations,
+		Answers:      answers,
+	}
+	if linked {
+		id := question.Id
+		result.BankQuestionId = &id
+	}
+
+	return result
+}
+
+func CreateBankQuestionDto(question *BankQuestion) *BankQuestionDto {
+	answers := make([]AnswerData, 0, len(question.Answers))
+	for _, answer := range question.Answers {
+		answers = append(answers, AnswerData{
+			Text:         answer.Text,
+			IsRight:      answer.IsRight,
+			Points:       answer.Points,
+			MediaId:      answer.MediaId,
+			Translations: answer.Translations,
+		})
+	}
+
+	return &BankQuestionDto{
+		Id: question.Id,
+		QuestionData: QuestionData{
+			Text:         question.Text,
+			Time:         question.Time,
+			MediaId:      question.MediaId,
+			Translations: question.Translations,
+			Answers:      answers,
+		},
+		Tags:       tagNames(question.Tags),
+		Difficulty: question.Difficulty,
+		CreatedAt:  question.CreatedAt,
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import "errors"
+
+var (
+	ErrLicensedClone  = errors.New("quizzes cloned from the work of another author cannot be sold")
+	ErrLicensedExport = errors.New("quizzes cloned from the work of another author cannot be exported")
+)
+
+// CloneQuiz copies a quiz with its questions and answers into a new draft of the account.
+// Owners clone the working copy, or the revision when a number is given, editors any
+// revision and buyers and viewers the revision they bought. Clones of quizzes of another
+// author are licensed and cannot be sold
+func CloneQuiz(quizId uint, userId uint, role string, number uint) (*QuizDto, error) {
+	acc, err := Db.GetAccountById(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	quiz, err := Db.GetQuizWithQuestions(quizId)
+	if err != nil {
+		return nil, err
+	}
+
+	if quiz.Status == QuizGenerated {
+		return nil, errors.New("generated quizzes cannot be cloned")
+	}
+
+	isOwner := quiz.OwnerId == acc.Id
+	source := QuizSource{
+		QuizId:   &quiz.Id,
+		Name:     quiz.Name,
+		Author:   quiz.Owner.Username,
+		Licensed: quiz.Source.Licensed || !isOwner,
+	}
+
+	name, description, questions := quiz.Name, quiz.Description, quiz.Questions
+	translations := quiz.Translations
+	if !isOwner || number != 0 {
+		revision, err := resolveRevision(quiz, acc.Id, role, number)
+		if err != nil {
+			return nil, err
+		}
+
+		source.Revision = revision.Number
+		name, description, questions = revision.Name, revision.Description, revision.Questions
+		translations = revision.Translations
+	}
+
+	clone := Quiz{
+		Name:         name,
+		Description:  description,
+		Questions:    copyQuestions(questions, 0),
+		OwnerId:      acc.Id,
+		Owner:        *acc,
+		Status:       QuizDraft,
+		CategoryId:   quiz.CategoryId,
+		Tags:         quiz.Tags,
+		Difficulty:   quiz.Difficulty,
+		Language:     quiz.Language,
+		Source:       source,
+		Translations: translations,
+	}
+
+	// Bank questions and media of another author are not shared with the clone
+	if !isOwner {
+		for i := range clone.Questions {
+			clone.Questions[i].BankQuestionId = nil
+		}
+
+		if err := copyQuizMedia(clone.Questions, acc.Id); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := Db.PostQuiz(&clone); err != nil {
+		return nil, err
+	}
+
+	dto := CreateQuizDto(&clone)
+	return &dto, nil
+}
+
+// copyQuizMedia gives the questions copies of the media that belong to another account
+func copyQuizMedia(questions []Question, ownerId uint) error {
+	var ids []uint
+	for _, question := range questions {
+		if question.MediaId != nil {
+			ids = append(ids, *question.MediaId)
+		}
+		for _, answer := range question.Answers {
+			if answer.MediaId != nil {
+				ids = append(ids, *answer.MediaId)
+			}
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	media, err := Db.GetMediaByIds(ids)
+	if err != nil {
+		return err
+	}
+
+	copies := make(map[uint]*uint, len(media))
+	for i := range media {
+		if media[i].OwnerId == ownerId {
+			continue
+		}
+
+		copied, err := copyMedia(&media[i], ownerId)
+		if err != nil {
+			return err
+		}
+		copies[media[i].Id] = &copied.Id
+	}
+
+	replace := func(id *uint) *uint {
+		if id != nil && copies[*id] != nil {
+			return copies[*id]
+		}
+		return id
+	}
+
+	for i := range questions {
+		questions[i].MediaId = replace(questions[i].MediaId)
+		for j := range questions[i].Answers {
+			questions[i].Answers[j].MediaId = replace(questions[i].Answers[j].MediaId)
+		}
+	}
+
+	return nil
+}
+
+// quizSource returns the attribution of a cloned quiz, nil for original quizzes
+func quizSource(quiz *Quiz) *QuizSource {
+	if quiz.Source.QuizId == nil {
+		return nil
+	}
+
+	source := quiz.Source
+	return &source
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"slices"
+)
+
+// Roles an account can have on a quiz. Owners and admins manage everything, editors change
+// the working copy and viewers only read it, playing, exporting or cloning it still takes
+// a purchase
+const (
+	QuizRoleOwner  = "owner"
+	QuizRoleEditor = "editor"
+	QuizRoleViewer = "viewer"
+)
+
+// Actions of the activity log besides the content changes, which use the change kinds
+const (
+	ActivityStatusChanged      = "status_changed"
+	ActivityCollaboratorSet    = "collaborator_set"
+	ActivityCollaboratorRemove = "collaborator_removed"
+)
+
+var (
+	ErrQuizConflict = errors.New("quiz was changed by someone else, load it again and repeat your changes")
+	ErrNotQuizOwner = errors.New("only the owner of the quiz can manage its co-authors")
+)
+
+// quizAccess returns the role of the account on the quiz, empty when it has none
+func quizAccess(quiz *Quiz, userId uint, role string) string {
+	if quiz.OwnerId == userId || role == Admin {
+		return QuizRoleOwner
+	}
+
+	collaborator, err := Db.GetQuizCollaborator(quiz.Id, userId)
+	if err != nil {
+		return ""
+	}
+
+	return collaborator.Role
+}
+
+func canViewQuiz(quiz *Quiz, userId uint, role string) bool {
+	return quizAccess(quiz, userId, role) != ""
+}
+
+func canEditQuiz(quiz *Quiz, userId uint, role string) bool {
+	access := quizAccess(quiz, userId, role)
+	return access == QuizRoleOwner || access == QuizRoleEditor
+}
+
+// quizAuthorIds returns the owner and the editors of the quiz, the accounts whose media
+// and bank questions the quiz may use
+func quizAuthorIds(quiz *Quiz) []uint {
+	ids := []uint{quiz.OwnerId}
+
+	collaborators, err := Db.GetQuizCollaborators(quiz.Id)
+	if err != nil {
+		log.Printf("failed to load co-authors of quiz %d: %v", quiz.Id, err)
+		return ids
+	}
+
+	for _, collaborator := range collaborators {
+		if collaborator.Role == QuizRoleEditor {
+			ids = append(ids, collaborator.AccountId)
+		}
+	}
+
+	return ids
+}
+
+func GetQuizCollaborators(quizId uint, userId uint, role string) ([]QuizCollaboratorDto, error) {
+	quiz, err := Db.GetQuizById(quizId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canViewQuiz(quiz, userId, role) {
+		return nil, ErrQuizNotAccessible
+	}
+
+	collaborators, err := Db.GetQuizCollaborators(quiz.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	collaboratorsDto := make([]QuizCollaboratorDto, 0, len(collaborators))
+	for _, collaborator := range collaborators {
+		collaboratorsDto = append(collaboratorsDto, *CreateQuizCollaboratorDto(&collaborator))
+	}
+
+	return collaboratorsDto, nil
+}
+
+// SetQuizCollaborator invites the account as a co-author of the quiz or changes its role
+func SetQuizCollaborator(quizId uint, username string, body *CollaboratorRequest, userId uint, role string) (*QuizCollaboratorDto, error) {
+	if body.Role != QuizRoleEditor && body.Role != QuizRoleViewer {
+		return nil, errors.New("role must be editor or viewer")
+	}
+
+	quiz, err := Db.GetQuizById(quizId)
+	if err != nil {
+		return nil, err
+	}
+
+	if quiz.OwnerId != userId && role != Admin {
+		return nil, ErrNotQuizOwner
+	}
+
+	acc, err := Db.GetAccountByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if acc.Id == quiz.OwnerId {
+		return nil, errors.New("the owner cannot be a co-author of their own quiz")
+	}
+
+	collaborator := QuizCollaborator{
+		QuizId:    quiz.Id,
+		AccountId: acc.Id,
+		Account:   *acc,
+		Role:      body.Role,
+	}
+
+	if err := Db.PutQuizCollaborator(&collaborator); err != nil {
+		return nil, err
+	}
+
+	recordQuizActivity(QuizActivity{QuizId: quiz.Id, AccountId: userId, Action: ActivityCollaboratorSet, Path: acc.Username, Detail: body.Role})
+	return CreateQuizCollaboratorDto(&collaborator), nil
+}
+
+// RemoveQuizCollaborator takes the account off the quiz, co-authors may also leave themselves
+func RemoveQuizCollaborator(quizId uint, username string, userId uint, role string) error {
+	quiz, err := Db.GetQuizById(quizId)
+	if err != nil {
+		return err
+	}
+
+	acc, err := Db.GetAccountByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	if quiz.OwnerId != userId && role != Admin && acc.Id != userId {
+		return ErrNotQuizOwner
+	}
+
+	if err := Db.DeleteQuizCollaborator(quiz.Id, acc.Id); err != nil {
+		return err
+	}
+
+	// The quiz keeps the questions it took from the bank of the removed editor, but they
+	// no longer follow changes to the bank
+	if err := Db.UnlinkBankQuestions(quiz.Id, acc.Id); err != nil {
+		return err
+	}
+
+	recordQuizActivity(QuizActivity{QuizId: quiz.Id, AccountId: userId, Action: ActivityCollaboratorRemove, Path: acc.Username})
+	return nil
+}
+
+// GetQuizActivity lists who changed what on the quiz, the latest entries first
+func GetQuizActivity(quizId uint, userId uint, role string, page *PageRequest) ([]QuizActivityDto, *PageInfo, error) {
+	quiz, err := Db.GetQuizById(quizId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !canViewQuiz(quiz, userId, role) {
+		return nil, nil, ErrQuizNotAccessible
+	}
+
+	activities, info, err := Db.GetQuizActivities(quiz.Id, page)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	activitiesDto := make([]QuizActivityDto, 0, len(activities))
+	for _, activity := range activities {
+		activitiesDto = append(activitiesDto, QuizActivityDto{
+			Username:  activity.Account.Username,
+			Action:    activity.Action,
+			Path:      activity.Path,
+			Detail:    activity.Detail,
+			CreatedAt: activity.CreatedAt,
+		})
+	}
+
+	return activitiesDto, info, nil
+}
+
+// recordQuizChanges logs the changes the account made to the working copy of the quiz
+func recordQuizChanges(quizId uint, accountId uint, changes []QuizChange) {
+	activities := make([]QuizActivity, 0, len(changes))
+	for _, change := range changes {
+		activities = append(activities, QuizActivity{QuizId: quizId, AccountId: accountId, Action: change.Kind, Path: change.Path})
+	}
+
+	recordQuizActivity(activities...)
+}
+
+// recordQuizActivity stores entries of the activity log. It runs after the change was
+// saved, which the editor should not see fail because its log entry was lost
+func recordQuizActivity(activities ...QuizActivity) {
+	if len(activities) == 0 {
+		return
+	}
+
+	if err := Db.PostQuizActivities(activities); err != nil {
+		log.Println("failed to store quiz activity: ", err)
+	}
+}
+
+func isQuizAuthor(authorIds []uint, accountId uint) bool {
+	return slices.Contains(authorIds, accountId)
+}
+
+func CreateQuizCollaboratorDto(collaborator *QuizCollaborator) *QuizCollaboratorDto {
+	return &QuizCollaboratorDto{
+		Username:  collaborator.Account.Username,
+		Role:      collaborator.Role,
+		CreatedAt: collaborator.CreatedAt,
+	}
+}
@@ -0,0 +1,647 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Formats quizzes can be imported from and exported to
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatGIFT = "gift"
+	FormatQTI  = "qti"
+)
+
+var ErrUnknownFormat = errors.New("format must be json, csv, gift or qti")
+
+// GetQuizDataSchema describes the JSON format, see QuizData
+func GetQuizDataSchema() JsonSchema {
+	return *schemaOf(reflect.TypeOf(QuizData{}))
+}
+
+// ImportQuiz reads a quiz in the format and saves it for the user unless only a preview
+// was asked for. CSV has no room for a name so it is passed separately
+func ImportQuiz(format string, document io.Reader, name string, userId uint, preview bool) (*QuizImportPreview, error) {
+	data, err := ParseQuiz(format, io.LimitReader(document, maxImportSize), name)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QuizImportPreview{QuizData: *data}
+	if preview {
+		return result, nil
+	}
+
+	quiz, err := CreateQuiz(CreateQuizRequestFromData(data), userId)
+	if err != nil {
+		return nil, err
+	}
+
+	result.QuizId = quiz.Id
+	return result, nil
+}
+
+// ExportQuiz returns the quiz in the format together with its content type. Licensed clones
+// are not exported, an import would lose the license and the quiz could be sold
+func ExportQuiz(quizId uint, userId uint, role string, format string) ([]byte, string, error) {
+	quiz, err := Db.GetQuizWithQuestions(quizId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !canEditQuiz(quiz, userId, role) {
+		return nil, "", errors.New("you do not have permission to export this quiz")
+	}
+
+	if quiz.Source.Licensed {
+		return nil, "", ErrLicensedExport
+	}
+
+	return FormatQuiz(format, QuizDataFromQuiz(quiz))
+}
+
+// ParseQuiz reads a quiz in the format, every problem found is reported with its line.
+// A non empty name replaces the name found in the document
+func ParseQuiz(format string, document io.Reader, name string) (*QuizData, error) {
+	var data *QuizData
+	var lines []int
+	var err error
+
+	switch format {
+	case FormatJSON:
+		data, err = parseQuizJson(document)
+	case FormatCSV:
+		data, lines, err = parseQuizCsv(document)
+	case FormatGIFT:
+		data, lines, err = parseQuizGift(document)
+	case FormatQTI:
+		data, err = parseQuizQti(document)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if name != "" {
+		data.Name = name
+	}
+
+	if errs := ValidateQuizData(data, lines); len(errs) > 0 {
+		return nil, errs
+	}
+
+	return data, nil
+}
+
+// FormatQuiz writes the quiz in the format together with its content type
+func FormatQuiz(format string, data *QuizData) ([]byte, string, error) {
+	switch format {
+	case FormatJSON:
+		out, err := json.MarshalIndent(data, "", "  ")
+		return out, "application/json", err
+	case FormatCSV:
+		out, err := formatQuizCsv(data)
+		return out, "text/csv", err
+	case FormatGIFT:
+		return formatQuizGift(data), "text/plain; charset=utf-8", nil
+	case FormatQTI:
+		out, err := formatQuizQti(data)
+		return out, "application/zip", err
+	}
+
+	return nil, "", ErrUnknownFormat
+}
+
+// FormatExtension is the file extension of exported quizzes in the format
+func FormatExtension(format string) string {
+	if format == FormatQTI {
+		return "zip"
+	}
+
+	return format
+}
+
+func QuizDataFromQuiz(quiz *Quiz) *QuizData {
+	data := QuizData{
+		Name:         quiz.Name,
+		Description:  quiz.Description,
+		Translations: withoutEmpty(quiz.Translations),
+		Questions:    make([]QuestionData, 0, len(quiz.Questions)),
+	}
+
+	for _, question := range quiz.Questions {
+		questionData := QuestionData{
+			Text:         question.Text,
+			Time:         question.Time,
+			MediaId:      question.MediaId,
+			Translations: withoutEmpty(question.Translations),
+			Answers:      make([]AnswerData, 0, len(question.Answers)),
+		}
+
+		for _, answer := range question.Answers {
+			questionData.Answers = append(questionData.Answers, AnswerData{
+				Text:         answer.Text,
+				IsRight:      answer.IsRight,
+				Points:       answer.Points,
+				MediaId:      answer.MediaId,
+				Translations: withoutEmpty(answer.Translations),
+			})
+		}
+
+		data.Questions = append(data.Questions, questionData)
+	}
+
+	return &data
+}
+
+func parseQuizJson(document io.Reader) (*QuizData, error) {
+	content, err := io.ReadAll(document)
+	if err != nil {
+		return nil, err
+	}
+
+	var data QuizData
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&data); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return nil, ValidationErrors{{Line: lineAt(content, syntaxErr.Offset), Message: syntaxErr.Error()}}
+		case errors.As(err, &typeErr):
+			return nil, ValidationErrors{{Line: lineAt(content, typeErr.Offset), Field: typeErr.Field, Message: typeErr.Error()}}
+		}
+		return nil, ValidationErrors{{Message: err.Error()}}
+	}
+
+	return &data, nil
+}
+
+// lineAt is the line of the byte offset in content
+func lineAt(content []byte, offset int64) int {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+
+	return bytes.Count(content[:offset], []byte("\n")) + 1
+}
+
+// The CSV format has a header and one row per question:
+//
+//	question,time,points,correct,answer1,answer2,...
+//
+// correct holds the 1 based numbers of the right answers separated by ";" and points is
+// what each right answer is worth, either once for all of them or in the same order
+var csvHeader = []string{"question", "time", "points", "correct"}
+
+func parseQuizCsv(document io.Reader) (*QuizData, []int, error) {
+	reader := csv.NewReader(document)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var data QuizData
+	var lines []int
+	var errs ValidationErrors
+
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return nil, nil, ValidationErrors{{Line: parseErr.Line, Message: parseErr.Err.Error()}}
+			}
+			return nil, nil, err
+		}
+
+		// Positions are only known for records that were read successfully
+		line, _ := reader.FieldPos(0)
+
+		if row == 0 && strings.EqualFold(strings.TrimSpace(record[0]), csvHeader[0]) {
+			continue
+		}
+
+		if len(record) < len(csvHeader)+1 {
+			errs = append(errs, ValidationError{Line: line, Message: "row needs a question, time, points, correct and at least one answer"})
+			continue
+		}
+
+		question := QuestionData{Text: strings.TrimSpace(record[0])}
+
+		time, err := strconv.ParseUint(strings.TrimSpace(record[1]), 10, 32)
+		if err != nil {
+			errs = append(errs, ValidationError{Line: line, Message: "time must be a whole number of seconds"})
+		}
+		question.Time = uint(time)
+
+		points, err := parsePoints(record[2])
+		if err != nil {
+			errs = append(errs, ValidationError{Line: line, Message: err.Error()})
+		}
+
+		answers := record[len(csvHeader):]
+		for len(answers) > 0 && strings.TrimSpace(answers[len(answers)-1]) == "" {
+			answers = answers[:len(answers)-1]
+		}
+		for _, text := range answers {
+			question.Answers = append(question.Answers, AnswerData{Text: strings.TrimSpace(text)})
+		}
+
+		correct := strings.Split(record[3], ";")
+		for _, number := range correct {
+			index, err := strconv.Atoi(strings.TrimSpace(number))
+			if err != nil || index < 1 || index > len(question.Answers) {
+				errs = append(errs, ValidationError{Line: line, Message: fmt.Sprintf("correct answer %q is not one of the answers", strings.TrimSpace(number))})
+				continue
+			}
+			question.Answers[index-1].IsRight = true
+		}
+
+		if points != nil {
+			if err := assignPoints(&question, points); err != nil {
+				errs = append(errs, ValidationError{Line: line, Message: err.Error()})
+			}
+		}
+
+		data.Questions = append(data.Questions, question)
+		lines = append(lines, line)
+	}
+
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	return &data, lines, nil
+}
+
+func formatQuizCsv(data *QuizData) ([]byte, error) {
+	maxAnswers := 0
+	for _, question := range data.Questions {
+		if len(question.Answers) > maxAnswers {
+			maxAnswers = len(question.Answers)
+		}
+	}
+
+	header := append([]string(nil), csvHeader...)
+	for i := 1; i <= maxAnswers; i++ {
+		header = append(header, fmt.Sprintf("answer%d", i))
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(header)
+
+	for _, question := range data.Questions {
+		var correct []string
+		answers := make([]string, maxAnswers)
+
+		for i, answer := range question.Answers {
+			answers[i] = answer.Text
+			if answer.IsRight {
+				correct = append(correct, strconv.Itoa(i+1))
+			}
+		}
+
+		record := []string{
+			question.Text,
+			strconv.FormatUint(uint64(question.Time), 10),
+			formatPoints(&question),
+			strings.Join(correct, ";"),
+		}
+		writer.Write(append(record, answers...))
+	}
+
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// GIFT is Moodle's text format. Multiple choice, short answer and true/false questions are
+// supported. Time and points have no place in GIFT and are kept in comments in front of
+// the question, points like in CSV. The quiz name is the category:
+//
+//	$CATEGORY: Capitals
+//	// description: Know your capitals
+//
+//	// time: 30
+//	// points: 1
+//	::Q1:: Capital of France? {=Paris ~Lyon ~Marseille}
+const (
+	giftCategory    = "$CATEGORY:"
+	giftDescription = "description:"
+	giftTime        = "time:"
+	giftPoints      = "points:"
+)
+
+func parseQuizGift(document io.Reader) (*QuizData, []int, error) {
+	var data QuizData
+	var lines []int
+	var errs ValidationErrors
+
+	time, points := uint(defaultImportTime), []uint{defaultImportPoints}
+	var block []string
+	blockLine := 0
+
+	flush := func() {
+		if len(block) == 0 {
+			return
+		}
+
+		question, err := parseGiftQuestion(strings.Join(block, "\n"), time, points)
+		if err != nil {
+			errs = append(errs, ValidationError{Line: blockLine, Message: err.Error()})
+		} else {
+			data.Questions = append(data.Questions, *question)
+			lines = append(lines, blockLine)
+		}
+
+		block = nil
+		time, points = defaultImportTime, []uint{defaultImportPoints}
+	}
+
+	scanner := bufio.NewScanner(document)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case text == "":
+			flush()
+		case strings.HasPrefix(text, "//"):
+			comment := strings.TrimSpace(strings.TrimPrefix(text, "//"))
+			switch {
+			case strings.HasPrefix(comment, giftDescription):
+				data.Description = strings.TrimSpace(strings.TrimPrefix(comment, giftDescription))
+			case strings.HasPrefix(comment, giftTime):
+				value, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(comment, giftTime)), 10, 32)
+				if err != nil {
+					errs = append(errs, ValidationError{Line: line, Message: "time must be a whole number of seconds"})
+				}
+				time = uint(value)
+			case strings.HasPrefix(comment, giftPoints):
+				value, err := parsePoints(strings.TrimPrefix(comment, giftPoints))
+				if err != nil {
+					errs = append(errs, ValidationError{Line: line, Message: err.Error()})
+				}
+				points = value
+			}
+		case strings.HasPrefix(text, giftCategory):
+			flush()
+			data.Name = strings.TrimSpace(strings.TrimPrefix(text, giftCategory))
+		default:
+			if len(block) == 0 {
+				blockLine = line
+			}
+			block = append(block, text)
+		}
+	}
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	return &data, lines, nil
+}
+
+func parseGiftQuestion(text string, time uint, points []uint) (*QuestionData, error) {
+	// The optional title is only a label
+	if strings.HasPrefix(text, "::") {
+		end := indexUnescaped(text[2:], "::")
+		if end < 0 {
+			return nil, errors.New("question title is not closed with ::")
+		}
+		text = text[end+4:]
+	}
+
+	open := indexUnescaped(text, "{")
+	if open < 0 {
+		return nil, errors.New("question has no answers in {}")
+	}
+	end := indexUnescaped(text[open:], "}")
+	if end < 0 {
+		return nil, errors.New("answers are not closed with }")
+	}
+	end += open
+
+	question := QuestionData{
+		Text: unescapeGift(strings.TrimSpace(text[:open] + " " + text[end+1:])),
+		Time: time,
+	}
+
+	body := strings.TrimSpace(text[open+1 : end])
+	switch strings.ToUpper(body) {
+	case "T", "TRUE", "F", "FALSE":
+		isTrue := strings.HasPrefix(strings.ToUpper(body), "T")
+		question.Answers = []AnswerData{
+			{Text: "True", IsRight: isTrue},
+			{Text: "False", IsRight: !isTrue},
+		}
+		if err := assignPoints(&question, points); err != nil {
+			return nil, err
+		}
+		return &question, nil
+	}
+
+	if strings.HasPrefix(body, "#") {
+		return nil, errors.New("numerical questions are not supported")
+	} else if indexUnescaped(body, "->") >= 0 {
+		return nil, errors.New("matching questions are not supported")
+	}
+
+	for _, token := range splitGiftAnswers(body) {
+		answer := AnswerData{IsRight: token[0] == '='}
+		token = strings.TrimSpace(token[1:])
+
+		// A weight like %50% makes an answer right when it is positive
+		if strings.HasPrefix(token, "%") {
+			end := strings.Index(token[1:], "%")
+			if end < 0 {
+				return nil, errors.New("answer weight is not closed with %")
+			}
+			weight, err := strconv.ParseFloat(token[1:end+1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("answer weight %q is not a number", token[1:end+1])
+			}
+			answer.IsRight = weight > 0
+			token = token[end+2:]
+		}
+
+		// Feedback is not shown by Quizzland
+		if feedback := indexUnescaped(token, "#"); feedback >= 0 {
+			token = token[:feedback]
+		}
+
+		answer.Text = unescapeGift(strings.TrimSpace(token))
+		question.Answers = append(question.Answers, answer)
+	}
+
+	if len(question.Answers) == 0 {
+		return nil, errors.New("question has no answers, start them with = or ~")
+	}
+
+	if err := assignPoints(&question, points); err != nil {
+		return nil, err
+	}
+
+	return &question, nil
+}
+
+// splitGiftAnswers splits the answer block at every unescaped = or ~
+func splitGiftAnswers(body string) []string {
+	var answers []string
+	start := -1
+
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			i++
+		case '=', '~':
+			if start >= 0 {
+				answers = append(answers, body[start:i])
+			}
+			start = i
+		}
+	}
+	if start >= 0 {
+		answers = append(answers, body[start:])
+	}
+
+	return answers
+}
+
+// indexUnescaped is strings.Index skipping matches escaped with a backslash
+func indexUnescaped(s string, substr string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], substr) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+var giftEscaper = strings.NewReplacer(`\`, `\\`, `~`, `\~`, `=`, `\=`, `#`, `\#`, `{`, `\{`, `}`, `\}`, `:`, `\:`)
+
+func unescapeGift(s string) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		out.WriteByte(s[i])
+	}
+
+	return out.String()
+}
+
+func formatQuizGift(data *QuizData) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "%s %s\n", giftCategory, data.Name)
+	if data.Description != "" {
+		fmt.Fprintf(&buf, "// %s %s\n", giftDescription, data.Description)
+	}
+
+	for i, question := range data.Questions {
+		fmt.Fprintf(&buf, "\n// %s %d\n// %s %s\n", giftTime, question.Time, giftPoints, formatPoints(&question))
+		fmt.Fprintf(&buf, "::Q%d:: %s {\n", i+1, giftEscaper.Replace(question.Text))
+		for _, answer := range question.Answers {
+			prefix := "~"
+			if answer.IsRight {
+				prefix = "="
+			}
+			fmt.Fprintf(&buf, "%s%s\n", prefix, giftEscaper.Replace(answer.Text))
+		}
+		buf.WriteString("}\n")
+	}
+
+	return buf.Bytes()
+}
+
+// parsePoints reads the points of the right answers, a single value or one per right
+// answer separated by ";"
+func parsePoints(value string) ([]uint, error) {
+	var points []uint
+	for _, part := range strings.Split(value, ";") {
+		number, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+		if err != nil {
+			return nil, errors.New("points must be whole numbers separated by ;")
+		}
+		points = append(points, uint(number))
+	}
+
+	return points, nil
+}
+
+// assignPoints gives the right answers of the question their points, a single value is
+// shared by all of them
+func assignPoints(question *QuestionData, points []uint) error {
+	right := 0
+	for _, answer := range question.Answers {
+		if answer.IsRight {
+			right++
+		}
+	}
+
+	if len(points) != 1 && len(points) != right {
+		return fmt.Errorf("%d points were given for %d right answers", len(points), right)
+	}
+
+	next := 0
+	for i := range question.Answers {
+		if !question.Answers[i].IsRight {
+			continue
+		}
+
+		question.Answers[i].Points = points[0]
+		if len(points) > 1 {
+			question.Answers[i].Points = points[next]
+		}
+		next++
+	}
+
+	return nil
+}
+
+// formatPoints writes the points of the right answers, once when they are all worth the same
+func formatPoints(question *QuestionData) string {
+	var points []string
+	for _, answer := range question.Answers {
+		if answer.IsRight {
+			points = append(points, strconv.FormatUint(uint64(answer.Points), 10))
+		}
+	}
+
+	if len(points) == 0 {
+		return "0"
+	}
+
+	for _, value := range points[1:] {
+		if value != points[0] {
+			return strings.Join(points, ";")
+		}
+	}
+
+	return points[0]
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func roundTripQuiz() *QuizData {
+	return &QuizData{
+		Name:        "Capitals",
+		Description: "Know your capitals",
+		Questions: []QuestionData{
+			{
+				Text: "Capital of France?",
+				Time: 30,
+				Answers: []AnswerData{
+					{Text: "Paris", IsRight: true, Points: 2},
+					{Text: "Lyon"},
+					{Text: "Marseille"},
+				},
+			},
+			{
+				Text: "Which are in Italy?",
+				Time: 45,
+				Answers: []AnswerData{
+					{Text: "Rome", IsRight: true, Points: 3},
+					{Text: "Vienna"},
+					{Text: "Milan", IsRight: true, Points: 1},
+				},
+			},
+			{
+				Text: "Special {=~#:} chars",
+				Time: 10,
+				Answers: []AnswerData{
+					{Text: "a \"quoted\", answer", IsRight: true, Points: 1},
+					{Text: "back\\slash"},
+				},
+			},
+		},
+	}
+}
+
+func TestFormatQuizRoundTrip(t *testing.T) {
+	tests := []struct {
+		format string
+		// prepare drops what the format cannot hold
+		prepare func(data *QuizData)
+	}{
+		{
+			format: FormatJSON,
+			prepare: func(data *QuizData) {
+				data.Translations = QuizTranslations{"de": {Name: "Hauptstädte"}}
+				data.Questions[0].Translations = TextTranslations{"de": "Hauptstadt von Frankreich?"}
+				data.Questions[0].Answers[1].Translations = TextTranslations{"de": "Lyon"}
+			},
+		},
+		{
+			// CSV has no room for the description, the name is passed separately
+			format:  FormatCSV,
+			prepare: func(data *QuizData) { data.Description = "" },
+		},
+		{
+			format:  FormatGIFT,
+			prepare: func(data *QuizData) {},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			want := roundTripQuiz()
+			test.prepare(want)
+
+			out, _, err := FormatQuiz(test.format, want)
+			if err != nil {
+				t.Fatalf("FormatQuiz: %v", err)
+			}
+
+			name := ""
+			if test.format == FormatCSV {
+				name = want.Name
+			}
+
+			got, err := ParseQuiz(test.format, bytes.NewReader(out), name)
+			if err != nil {
+				t.Fatalf("ParseQuiz: %v\n%s", err, out)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip changed the quiz\ngot:  %+v\nwant: %+v\ndocument:\n%s", got, want, out)
+			}
+		})
+	}
+}
+
+func TestParseQuizMalformed(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		document string
+		line     int
+		message  string
+	}{
+		{
+			name:     "csv unterminated quote in first row",
+			format:   FormatCSV,
+			document: "\"question,time,points,correct,answer1\n",
+			line:     1,
+			message:  "quote",
+		},
+		{
+			name:     "csv unterminated quote after header",
+			format:   FormatCSV,
+			document: "question,time,points,correct,answer1\n\"Capital?,30,1,1,Paris\n",
+			line:     2,
+			message:  "quote",
+		},
+		{
+			name:     "csv too few columns",
+			format:   FormatCSV,
+			document: "question,time,points,correct,answer1\nCapital?,30,1\n",
+			line:     2,
+			message:  "at least one answer",
+		},
+		{
+			name:     "csv correct answer out of range",
+			format:   FormatCSV,
+			document: "Capital?,30,1,3,Paris,Lyon\n",
+			line:     1,
+			message:  "not one of the answers",
+		},
+		{
+			name:     "csv points do not match right answers",
+			format:   FormatCSV,
+			document: "Capital?,30,1;2;3,1;2,Paris,Lyon\n",
+			line:     1,
+			message:  "3 points were given for 2 right answers",
+		},
+		{
+			name:     "csv points not a number",
+			format:   FormatCSV,
+			document: "Capital?,30,many,1,Paris,Lyon\n",
+			line:     1,
+			message:  "points must be whole numbers",
+		},
+		{
+			name:     "gift answers not closed",
+			format:   FormatGIFT,
+			document: "$CATEGORY: Capitals\n\n::Q1:: Capital? {=Paris ~Lyon\n",
+			line:     3,
+			message:  "not closed with }",
+		},
+		{
+			name:     "gift numerical question",
+			format:   FormatGIFT,
+			document: "::Q1:: Two plus two? {#4}\n",
+			line:     1,
+			message:  "numerical questions are not supported",
+		},
+		{
+			name:     "json syntax error",
+			format:   FormatJSON,
+			document: "{\n\"name\": \"Capitals\",\n\"questions\": [\n}",
+			line:     4,
+			message:  "invalid character",
+		},
+		{
+			name:     "json unknown field",
+			format:   FormatJSON,
+			document: "{\"title\": \"Capitals\"}",
+			message:  "unknown field",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseQuiz(test.format, strings.NewReader(test.document), "Capitals")
+
+			var errs ValidationErrors
+			if !errors.As(err, &errs) || len(errs) == 0 {
+				t.Fatalf("expected validation errors, got %v", err)
+			}
+
+			if errs[0].Line != test.line {
+				t.Errorf("line = %d, want %d", errs[0].Line, test.line)
+			}
+			if !strings.Contains(errs[0].Message, test.message) {
+				t.Errorf("message = %q, want it to contain %q", errs[0].Message, test.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+)
+
+// Statuses of a quiz. Only published quizzes can be played or bought, the content that is
+// played is always the latest published revision
+const (
+	QuizDraft     = "draft"
+	QuizInReview  = "in_review"
+	QuizPublished = "published"
+	QuizArchived  = "archived"
+	// QuizGenerated quizzes hold the questions drawn for a random game and never change
+	QuizGenerated = "generated"
+)
+
+// Actions that move a quiz between statuses
+const (
+	QuizActionSubmit  = "submit"
+	QuizActionPublish = "publish"
+	QuizActionReject  = "reject"
+	QuizActionArchive = "archive"
+	QuizActionRestore = "restore"
+)
+
+var (
+	ErrQuizNotPublished = errors.New("quiz is not published")
+	ErrQuizLocked       = errors.New("quiz cannot be changed while it is in review or archived")
+	ErrNothingToPublish = errors.New("quiz has no changes since its latest revision")
+)
+
+// ChangeQuizStatus applies the action to the quiz. Owners submit drafts for review and an
+// admin publishes or rejects them, once a quiz was published its owner can publish new
+// revisions without another review. Submitting and publishing fail with ValidationErrors
+// when the quiz is not complete
+func ChangeQuizStatus(quizId uint, action string, userId uint, role string) (*QuizDto, error) {
+	quiz, err := Db.GetQuizWithQuestions(quizId)
+	if err != nil {
+		return nil, err
+	}
+
+	isOwner := quiz.OwnerId == userId
+	isAdmin := role == Admin
+	if !isOwner && !isAdmin {
+		return nil, ErrQuizNotAccessible
+	}
+
+	if quiz.Status == QuizGenerated {
+		return nil, errors.New("generated quizzes cannot change their status")
+	}
+
+	status := quiz.Status
+	switch action {
+	case QuizActionSubmit:
+		if quiz.Status != QuizDraft {
+			return nil, errors.New("only drafts can be submitted for review")
+		}
+		if errs, err := validateQuizForPublishing(quiz); err != nil {
+			return nil, err
+		} else if len(errs) > 0 {
+			return nil, errs
+		}
+
+		status = QuizInReview
+	case QuizActionPublish:
+		switch {
+		case quiz.Status == QuizPublished:
+		case isAdmin && (quiz.Status == QuizInReview || quiz.Status == QuizDraft):
+		default:
+			return nil, errors.New("quiz has to be reviewed by an admin before it is published")
+		}
+
+		if errs, err := validateQuizForPublishing(quiz); err != nil {
+			return nil, err
+		} else if len(errs) > 0 {
+			return nil, errs
+		}
+		if err := ensureQuizChanged(quiz); err != nil {
+			return nil, err
+		}
+		if _, err := publishRevision(quiz); err != nil {
+			return nil, err
+		}
+
+		status = QuizPublished
+	case QuizActionReject:
+		if !isAdmin || quiz.Status != QuizInReview {
+			return nil, errors.New("only an admin can reject a quiz in review")
+		}
+
+		status = QuizDraft
+	case QuizActionArchive:
+		if quiz.Status == QuizArchived {
+			return nil, errors.New("quiz is already archived")
+		}
+
+		status = QuizArchived
+	case QuizActionRestore:
+		if quiz.Status != QuizArchived {
+			return nil, errors.New("only archived quizzes can be restored")
+		}
+
+		status = QuizDraft
+		if quiz.LatestRevision > 0 {
+			status = QuizPublished
+		}
+	default:
+		return nil, errors.New("unknown action")
+	}
+
+	if err := Db.UpdateQuizStatus(quiz.Id, status); err != nil {
+		return nil, err
+	}
+
+	quiz.Status = status
+	quiz.Version++
+	recordQuizActivity(QuizActivity{QuizId: quiz.Id, AccountId: userId, Action: ActivityStatusChanged, Path: "status", Detail: status})
+	reindexQuiz(quiz.Id)
+	dto := CreateQuizDto(quiz)
+	return &dto, nil
+}
+
+// validateQuizForPublishing are the gates a quiz has to pass before it is reviewed or
+// published, the same rules imported quizzes are held to
+func validateQuizForPublishing(quiz *Quiz) (ValidationErrors, error) {
+	return validateQuiz(quiz)
+}
+
+// ensureQuizChanged stops a published quiz from getting a revision equal to the last one
+func ensureQuizChanged(quiz *Quiz) error {
+	if quiz.LatestRevision == 0 {
+		return nil
+	}
+
+	latest, err := Db.GetQuizRevision(quiz.Id, quiz.LatestRevision)
+	if err != nil {
+		return err
+	}
+
+	if reflect.DeepEqual(QuizDataFromRevision(latest), QuizDataFromQuiz(quiz)) {
+		return ErrNothingToPublish
+	}
+
+	return nil
+}
+
+// isQuizEditable tells whether the working copy of the quiz can be changed, a published
+// quiz can be edited and the changes go live with its next revision
+func isQuizEditable(quiz *Quiz) bool {
+	return quiz.Status == QuizDraft || quiz.Status == QuizPublished
+}
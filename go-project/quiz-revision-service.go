@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+var (
+	ErrNoPublishedRevision = errors.New("quiz has no published revision")
+	ErrQuizNotAccessible   = errors.New("you do not have permission to access this quiz")
+	ErrNotPurchased        = errors.New("you have not bought this quiz")
+)
+
+// publishRevision copies the working copy of the quiz, which needs its questions and
+// answers loaded, into a new immutable revision
+func publishRevision(quiz *Quiz) (*QuizRevision, error) {
+	revision := QuizRevision{
+		QuizId:       quiz.Id,
+		Number:       quiz.LatestRevision + 1,
+		Name:         quiz.Name,
+		Description:  quiz.Description,
+		Questions:    copyQuestions(quiz.Questions, quiz.Id),
+		Language:     quiz.Language,
+		Translations: quiz.Translations,
+	}
+
+	if err := Db.PostQuizRevision(&revision); err != nil {
+		return nil, err
+	}
+
+	quiz.LatestRevision = revision.Number
+	quiz.Version++
+	return &revision, nil
+}
+
+// copyQuestions returns the questions and their answers without ids so they can be
+// saved as new rows
+func copyQuestions(questions []Question, quizId uint) []Question {
+	copies := make([]Question, 0, len(questions))
+	for _, question := range questions {
+		answers := make([]Answer, 0, len(question.Answers))
+		for _, answer := range question.Answers {
+			answers = append(answers, Answer{
+				Text:         answer.Text,
+				IsRight:      answer.IsRight,
+				Points:       answer.Points,
+				MediaId:      answer.MediaId,
+				Translations: answer.Translations,
+			})
+		}
+
+		copies = append(copies, Question{
+			Text:                question.Text,
+			Time:                question.Time,
+			Answers:             answers,
+			CorrespondingQuizId: quizId,
+			MediaId:             question.MediaId,
+			BankQuestionId:      question.BankQuestionId,
+			Translations:        question.Translations,
+		})
+	}
+
+	return copies
+}
+
+// resolveRevision picks the revision the account plays. Owners and editors get the one they
+// ask for or the latest, buyers and viewers the one their purchase is pinned to
+func resolveRevision(quiz *Quiz, userId uint, role string, number uint) (*QuizRevision, error) {
+	if canEditQuiz(quiz, userId, role) {
+		if number == 0 {
+			number = quiz.LatestRevision
+		}
+		if number == 0 {
+			return nil, ErrNoPublishedRevision
+		}
+
+		return Db.GetQuizRevision(quiz.Id, number)
+	}
+
+	purchase, err := Db.GetPurchase(userId, quiz.Id)
+	if err != nil {
+		return nil, ErrNotPurchased
+	}
+
+	if number != 0 && number != purchase.Revision.Number {
+		return nil, fmt.Errorf("you bought revision %d of this quiz", purchase.Revision.Number)
+	}
+
+	return Db.GetQuizRevision(quiz.Id, purchase.Revision.Number)
+}
+
+func GetQuizRevisions(quizId uint, userId uint, role string, page *PageRequest) ([]QuizRevisionDto, *PageInfo, error) {
+	quiz, err := Db.GetQuizById(quizId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !canViewQuiz(quiz, userId, role) {
+		return nil, nil, ErrQuizNotAccessible
+	}
+
+	revisions, info, err := Db.GetQuizRevisions(quiz.Id, page)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dtos := make([]QuizRevisionDto, 0, len(revisions))
+	for _, revision := range revisions {
+		dtos = append(dtos, QuizRevisionDto{
+			Number:        revision.Number,
+			Name:          revision.Name,
+			Description:   revision.Description,
+			QuestionCount: len(revision.Questions),
+			CreatedAt:     revision.CreatedAt,
+		})
+	}
+
+	return dtos, info, nil
+}
+
+// GetQuizRevision returns the content of a revision, buyers can only see the one they own
+func GetQuizRevision(quizId uint, number uint, userId uint, role string) (*QuizData, error) {
+	quiz, err := Db.GetQuizById(quizId)
+	if err != nil {
+		return nil, err
+	}
+
+	revision, err := resolveRevision(quiz, userId, role, number)
+	if err != nil {
+		return nil, err
+	}
+
+	return QuizDataFromRevision(revision), nil
+}
+
+func QuizDataFromRevision(revision *QuizRevision) *QuizData {
+	return QuizDataFromQuiz(&Quiz{
+		Name:         revision.Name,
+		Description:  revision.Description,
+		Questions:    revision.Questions,
+		Translations: revision.Translations,
+	})
+}
+
+// DiffQuizRevisions compares two revisions of a quiz, only its owner can see them
+func DiffQuizRevisions(quizId uint, from uint, to uint, userId uint, role string) (*QuizDiff, error) {
+	quiz, err := Db.GetQuizById(quizId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canViewQuiz(quiz, userId, role) {
+		return nil, ErrQuizNotAccessible
+	}
+
+	if to == 0 {
+		to = quiz.LatestRevision
+	}
+	if from == 0 && to > 1 {
+		from = to - 1
+	}
+
+	oldRevision, err := Db.GetQuizRevision(quiz.Id, from)
+	if err != nil {
+		return nil, fmt.Errorf("revision %d: %w", from, err)
+	}
+
+	newRevision, err := Db.GetQuizRevision(quiz.Id, to)
+	if err != nil {
+		return nil, fmt.Errorf("revision %d: %w", to, err)
+	}
+
+	return &QuizDiff{
+		From:    from,
+		To:      to,
+		Changes: diffQuizData(QuizDataFromRevision(oldRevision), QuizDataFromRevision(newRevision)),
+	}, nil
+}
+
+func diffQuizData(old *QuizData, new *QuizData) []QuizChange {
+	changes := make([]QuizChange, 0)
+
+	diffValue := func(path string, o interface{}, n interface{}) {
+		if !reflect.DeepEqual(o, n) {
+			changes = append(changes, QuizChange{Path: path, Kind: ChangeChanged, Old: o, New: n})
+		}
+	}
+
+	diffValue("name", old.Name, new.Name)
+	diffValue("description", old.Description, new.Description)
+	diffValue("translations", old.Translations, new.Translations)
+
+	for i := 0; i < len(old.Questions) || i < len(new.Questions); i++ {
+		path := fmt.Sprintf("questions[%d]", i)
+		switch {
+		case i >= len(old.Questions):
+			changes = append(changes, QuizChange{Path: path, Kind: ChangeAdded, New: new.Questions[i]})
+			continue
+		case i >= len(new.Questions):
+			changes = append(changes, QuizChange{Path: path, Kind: ChangeRemoved, Old: old.Questions[i]})
+			continue
+		}
+
+		oldQuestion, newQuestion := old.Questions[i], new.Questions[i]
+		diffValue(path+".text", oldQuestion.Text, newQuestion.Text)
+		diffValue(path+".time", oldQuestion.Time, newQuestion.Time)
+		diffValue(path+".translations", oldQuestion.Translations, newQuestion.Translations)
+
+		for j := 0; j < len(oldQuestion.Answers) || j < len(newQuestion.Answers); j++ {
+			answerPath := fmt.Sprintf("%s.answers[%d]", path, j)
+			switch {
+			case j >= len(oldQuestion.Answers):
+				changes = append(changes, QuizChange{Path: answerPath, Kind: ChangeAdded, New: newQuestion.Answers[j]})
+			case j >= len(newQuestion.Answers):
+				changes = append(changes, QuizChange{Path: answerPath, Kind: ChangeRemoved, Old: oldQuestion.Answers[j]})
+			default:
+				diffValue(answerPath, oldQuestion.Answers[j], newQuestion.Answers[j])
+			}
+		}
+	}
+
+	return changes
+}
+
+func GetPurchases(userId uint, page *PageRequest) ([]PurchaseDto, *PageInfo, error) {
+	purchases, info, err := Db.GetPurchasesByAccountId(userId, page)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dtos := make([]PurchaseDto, 0, len(purchases))
+	for _, purchase := range purchases {
+		dtos = append(dtos, *CreatePurchaseDto(&purchase))
+	}
+
+	return dtos, info, nil
+}
+
+// UpgradePurchase moves a purchase to the latest revision of its quiz, buyers stay on the
+// revision they bought until they ask for this
+func UpgradePurchase(quizId uint, userId uint) (*PurchaseDto, error) {
+	purchase, err := Db.GetPurchase(userId, quizId)
+	if err != nil {
+		return nil, ErrNotPurchased
+	}
+
+	quiz, err := Db.GetQuizById(quizId)
+	if err != nil {
+		return nil, err
+	}
+
+	if quiz.LatestRevision == purchase.Revision.Number {
+		return nil, errors.New("purchase is already on the latest revision")
+	}
+
+	revision, err := Db.GetQuizRevision(quiz.Id, quiz.LatestRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	purchase.RevisionId = revision.Id
+	purchase.Revision = *revision
+	if err := Db.PutPurchase(purchase); err != nil {
+		return nil, err
+	}
+
+	purchase.Quiz = *quiz
+	return CreatePurchaseDto(purchase), nil
+}
+
+func CreatePurchaseDto(purchase *Purchase) *PurchaseDto {
+	return &PurchaseDto{
+		Quiz:             CreateQuizDto(&purchase.Quiz),
+		Revision:         purchase.Revision.Number,
+		UpgradeAvailable: purchase.Quiz.LatestRevision > purchase.Revision.Number,
+		PurchasedAt:      purchase.CreatedAt,
+	}
+}
+
+// newPurchase pins the latest revision of the quiz for the buyer
+func newPurchase(accountId uint, quiz *Quiz) (*Purchase, error) {
+	if quiz.LatestRevision == 0 {
+		return nil, ErrNoPublishedRevision
+	}
+
+	revision, err := Db.GetQuizRevision(quiz.Id, quiz.LatestRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Purchase{
+		AccountId:  accountId,
+		QuizId:     quiz.Id,
+		RevisionId: revision.Id,
+	}, nil
+}
@@ -2,40 +2,112 @@ package main
 
 import "errors"
 
-func CreateQuiz(body *CreateQuizRequest, userId uint) error {
+// CreateQuiz saves a new draft, it fails with ValidationErrors when the quiz is not valid
+func CreateQuiz(body *CreateQuizRequest, userId uint) (*Quiz, error) {
 	acc, err := Db.GetAccountById(userId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	quiz := Quiz{
-		Name:        body.Name,
-		Description: body.Description,
-		Questions:   body.Questions,
-		OwnerId:     acc.Id,
-		Owner:       *acc,
+		Name:         body.Name,
+		Description:  body.Description,
+		Questions:    copyQuestions(body.Questions, 0),
+		OwnerId:      acc.Id,
+		Owner:        *acc,
+		Status:       QuizDraft,
+		Translations: body.Translations,
+	}
+
+	errs, err := resolveBankQuestions(quiz.Questions, []uint{quiz.OwnerId})
+	if err != nil {
+		return nil, err
+	}
+
+	quizErrs, err := validateQuiz(&quiz)
+	if err != nil {
+		return nil, err
+	}
+
+	errs = append(errs, quizErrs...)
+	errs = append(errs, validateQuizMetadata(&body.QuizMetadata)...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	if err := applyQuizMetadata(&quiz, &body.QuizMetadata); err != nil {
+		return nil, err
 	}
 
 	err = Db.PostQuiz(&quiz)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &quiz, nil
 }
 
-func GetQuizzesForSale() ([]ProductDto, error) {
-	products, err := Db.GetProducts()
+// GetQuiz returns a published quiz, drafts are only visible to their owner and admins
+func GetQuiz(id uint, userId uint, role string) (*QuizDto, error) {
+	quiz, err := Db.GetQuizWithQuestions(id)
 	if err != nil {
 		return nil, err
 	}
 
-	productsDto := make([]ProductDto, len(products))
+	access := quizAccess(quiz, userId, role)
+	if quiz.Status != QuizPublished && access == "" {
+		return nil, ErrQuizNotAccessible
+	}
+
+	dto := CreateQuizDto(quiz)
+	dto.Access = access
+	return &dto, nil
+}
+
+// GetQuizzesOfOwner lists the quizzes of an account, others only see the published ones
+func GetQuizzesOfOwner(username string, userId uint, role string, page *PageRequest) ([]QuizDto, *PageInfo, error) {
+	owner, err := Db.GetAccountByUsername(username)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publishedOnly := owner.Id != userId && role != Admin
+	quizzes, info, err := Db.GetQuizzesByOwnerId(owner.Id, publishedOnly, page)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	quizzesDto := make([]QuizDto, 0, len(quizzes))
+	for _, quiz := range quizzes {
+		quizzesDto = append(quizzesDto, CreateQuizDto(&quiz))
+	}
+
+	return quizzesDto, info, nil
+}
+
+// GetQuizzesForSale lists the products of published quizzes that match the filter
+func GetQuizzesForSale(filter *ProductFilter, page *PageRequest) ([]ProductDto, *PageInfo, error) {
+	var categoryIds []uint
+	if filter.CategoryId != 0 {
+		ids, err := categoryWithDescendants(filter.CategoryId)
+		if err != nil {
+			return nil, nil, err
+		}
+		categoryIds = ids
+	}
+
+	filter.Tags = normalizeTags(filter.Tags)
+	products, info, err := Db.GetProductsForSale(filter, categoryIds, page)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	productsDto := make([]ProductDto, 0, len(products))
 	for _, product := range products {
 		productsDto = append(productsDto, *CreateProductDto(&product))
 	}
 
-	return productsDto, nil
+	return productsDto, info, nil
 }
 
 func DeleteQuiz(id int) error {
@@ -43,45 +115,123 @@ func DeleteQuiz(id int) error {
 		return err
 	}
 
+	reindexQuiz(uint(id))
+
 	return nil
 }
 
+// ModifyQuiz replaces the working copy of the quiz, the changes are played once the quiz
+// is published again. Owners and editors can modify a quiz, the save fails with
+// ErrQuizConflict when the quiz changed since the version the request is based on. Like
+// CreateQuiz it fails with ValidationErrors
 func ModifyQuiz(body *ModifyQuizRequest, userId uint, role string) error {
-	acc, err := Db.GetAccountById(userId)
+	quiz, err := Db.GetQuizWithQuestions(body.Id)
 	if err != nil {
 		return err
 	}
 
-	if !IsQuizExistingInAccount(acc, body.Id) && role != Admin {
+	if !canEditQuiz(quiz, userId, role) {
 		return errors.New("you do not have permission to modify this resource")
 	}
 
-	quiz := Quiz{
-		Id:          body.Id,
-		Name:        body.Name,
-		Description: body.Description,
-		Questions:   body.Questions,
-		OwnerId:     acc.Id,
-		Owner:       *acc,
+	if !isQuizEditable(quiz) {
+		return ErrQuizLocked
 	}
 
-	err = Db.PostQuiz(&quiz)
+	if body.Version != quiz.Version {
+		return ErrQuizConflict
+	}
+
+	before := QuizDataFromQuiz(quiz)
+	quiz.Name = body.Name
+	quiz.Description = body.Description
+	quiz.Translations = body.Translations
+	quiz.Questions = copyQuestions(body.Questions, quiz.Id)
+
+	errs, err := resolveBankQuestions(quiz.Questions, quizAuthorIds(quiz))
 	if err != nil {
 		return err
 	}
 
+	quizErrs, err := validateQuiz(quiz)
+	if err != nil {
+		return err
+	}
+
+	errs = append(errs, quizErrs...)
+	errs = append(errs, validateQuizMetadata(&body.QuizMetadata)...)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if err := applyQuizMetadata(quiz, &body.QuizMetadata); err != nil {
+		return err
+	}
+
+	err = Db.PutQuizWithQuestions(quiz)
+	if err != nil {
+		return err
+	}
+
+	recordQuizChanges(quiz.Id, userId, diffQuizData(before, QuizDataFromQuiz(quiz)))
+	reindexQuiz(quiz.Id)
 	return nil
 }
 
+// validateQuiz checks the content of the quiz and that it only uses media of its authors
+func validateQuiz(quiz *Quiz) (ValidationErrors, error) {
+	data := QuizDataFromQuiz(quiz)
+
+	mediaErrs, err := validateQuizMedia(data, quizAuthorIds(quiz))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(ValidateQuizData(data, nil), mediaErrs...), nil
+}
+
+// CreateQuizRequestFromData turns imported quiz data into a request for CreateQuiz
+func CreateQuizRequestFromData(data *QuizData) *CreateQuizRequest {
+	questions := make([]Question, 0, len(data.Questions))
+	for _, questionData := range data.Questions {
+		answers := make([]Answer, 0, len(questionData.Answers))
+		for _, answerData := range questionData.Answers {
+			answers = append(answers, Answer{
+				Text:         answerData.Text,
+				IsRight:      answerData.IsRight,
+				Points:       answerData.Points,
+				MediaId:      answerData.MediaId,
+				Translations: answerData.Translations,
+			})
+		}
+
+		questions = append(questions, Question{
+			Text:         questionData.Text,
+			Time:         questionData.Time,
+			MediaId:      questionData.MediaId,
+			Translations: questionData.Translations,
+			Answers:      answers,
+		})
+	}
+
+	return &CreateQuizRequest{
+		Name:         data.Name,
+		Description:  data.Description,
+		Questions:    questions,
+		Translations: data.Translations,
+	}
+}
+
 func createAnswerDto(answer Answer) *AnswerDto {
 	return &AnswerDto{
-		Id:   answer.Id,
-		Text: answer.Text,
+		Id:    answer.Id,
+		Text:  answer.Text,
+		Media: CreateMediaDto(answer.Media),
 	}
 }
 
 func CreateQuestionDto(Question Question) *QuestionDto {
-	answers := make([]AnswerDto, 4)
+	answers := make([]AnswerDto, 0, len(Question.Answers))
 	for _, answer := range Question.Answers {
 		answers = append(answers, *createAnswerDto(answer))
 	}
@@ -90,16 +240,26 @@ func CreateQuestionDto(Question Question) *QuestionDto {
 		Id:      Question.Id,
 		Text:    Question.Text,
 		Time:    Question.Time,
+		Media:   CreateMediaDto(Question.Media),
 		Answers: answers,
 	}
 }
 
 func CreateQuizDto(quiz *Quiz) QuizDto {
 	return QuizDto{
-		Id:          quiz.Id,
-		Name:        quiz.Name,
-		Description: quiz.Description,
-		Owner:       quiz.Owner.Username,
+		Id:             quiz.Id,
+		Name:           quiz.Name,
+		Description:    quiz.Description,
+		Owner:          quiz.Owner.Username,
+		LatestRevision: quiz.LatestRevision,
+		Status:         quiz.Status,
+		CategoryId:     quiz.CategoryId,
+		Category:       categoryName(quiz.Category),
+		Tags:           tagNames(quiz.Tags),
+		Difficulty:     quiz.Difficulty,
+		Language:       quiz.Language,
+		Source:         quizSource(quiz),
+		Translations:   quiz.Translations,
 	}
 }
 
@@ -18,16 +18,18 @@ func DeleteRating(id uint, userId uint, role string) error {
 		return err
 	}
 
+	reindexProduct(rating.CorrespondingProductId)
+
 	return nil
 }
 
-func GetRatingsForProduct(productId uint) ([]Rating, error) {
-	ratings, err := Db.GetRatingsByProductId(productId)
+func GetRatingsForProduct(productId uint, page *PageRequest) ([]Rating, *PageInfo, error) {
+	ratings, info, err := Db.GetRatingsByProductId(productId, page)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return ratings, nil
+	return ratings, info, nil
 }
 
 func CreateRating(body *CreateRatingRequest, userId uint) error {
@@ -57,6 +59,7 @@ func CreateRating(body *CreateRatingRequest, userId uint) error {
 		Owner:                  *acc,
 	}
 	Db.PostRating(&rating)
+	reindexQuiz(product.ItemId)
 
 	return nil
 }
@@ -85,6 +88,7 @@ func ModifyRating(body *ModifyRatingRequest, userId uint, role string) error {
 	rating.Value = uint8(body.Rating)
 
 	Db.PostRating(rating)
+	reindexProduct(rating.CorrespondingProductId)
 
 	return nil
 }
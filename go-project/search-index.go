@@ -0,0 +1,397 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Sorts of the search results, see searchSorts
+const (
+	SortRelevance = "relevance"
+	SortPrice     = "price"
+	SortRating    = "rating"
+	SortNewest    = "newest"
+)
+
+// searchSort is how hits are ordered by a sort and the direction used when none is asked for
+type searchSort struct {
+	value     func(hit *SearchHit) float64
+	direction string
+}
+
+var searchSorts = map[string]searchSort{
+	SortRelevance: {func(hit *SearchHit) float64 { return hit.Score }, SortDesc},
+	SortPrice:     {func(hit *SearchHit) float64 { return float64(hit.Price) }, SortAsc},
+	SortRating:    {func(hit *SearchHit) float64 { return hit.Rating }, SortDesc},
+	SortNewest:    {func(hit *SearchHit) float64 { return float64(hit.ProductId) }, SortDesc},
+}
+
+// Weights of the fields of a document, a match in the name counts more than one in the
+// text of a question
+const (
+	weightName        = 5
+	weightTag         = 4
+	weightOwner       = 3
+	weightDescription = 2
+	weightQuestion    = 1
+	// prefixMatchWeight is how much a word that only starts with a query term counts
+	prefixMatchWeight = 0.7
+)
+
+// SearchIndex keeps the quizzes on the marketplace searchable. Documents are replaced as a
+// whole whenever something about the quiz or its product changes
+type SearchIndex interface {
+	Index(doc SearchDocument) error
+	Remove(quizId uint) error
+	Search(query *SearchQuery, page *PageRequest) ([]SearchHit, *PageInfo, error)
+}
+
+var Search SearchIndex
+
+// SearchDocument is what is indexed about a quiz that is for sale
+type SearchDocument struct {
+	QuizId      uint     `json:"quizId"`
+	ProductId   uint     `json:"productId"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Owner       string   `json:"owner"`
+	Tags        []string `json:"tags"`
+	Questions   []string `json:"-"`
+	CategoryId  *uint    `json:"categoryId"`
+	Difficulty  string   `json:"difficulty"`
+	Language    string   `json:"language"`
+	Price       float32  `json:"price"`
+	Rating      float64  `json:"rating"`
+}
+
+type SearchQuery struct {
+	Text        string
+	MinPrice    *float32
+	MaxPrice    *float32
+	MinRating   float64
+	CategoryIds []uint
+	Difficulty  string
+	Language    string
+}
+
+type SearchHit struct {
+	SearchDocument
+	Score float64 `json:"score"`
+}
+
+// MemoryIndex is an inverted index kept in memory, it is rebuilt from the database when
+// the server starts
+type MemoryIndex struct {
+	sync.RWMutex
+	docs map[uint]*SearchDocument
+	// postings maps a term to the weighted number of times it is found in each quiz
+	postings map[string]map[uint]float64
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		docs:     make(map[uint]*SearchDocument),
+		postings: make(map[string]map[uint]float64),
+	}
+}
+
+func (m *MemoryIndex) Index(doc SearchDocument) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.remove(doc.QuizId)
+	m.docs[doc.QuizId] = &doc
+
+	add := func(text string, weight float64) {
+		for _, term := range tokenize(text) {
+			posting, ok := m.postings[term]
+			if !ok {
+				posting = make(map[uint]float64)
+				m.postings[term] = posting
+			}
+			posting[doc.QuizId] += weight
+		}
+	}
+
+	add(doc.Name, weightName)
+	add(doc.Description, weightDescription)
+	add(doc.Owner, weightOwner)
+	for _, tag := range doc.Tags {
+		add(tag, weightTag)
+	}
+	for _, question := range doc.Questions {
+		add(question, weightQuestion)
+	}
+
+	return nil
+}
+
+func (m *MemoryIndex) Remove(quizId uint) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.remove(quizId)
+	return nil
+}
+
+func (m *MemoryIndex) remove(quizId uint) {
+	if _, ok := m.docs[quizId]; !ok {
+		return
+	}
+
+	delete(m.docs, quizId)
+	for term, posting := range m.postings {
+		delete(posting, quizId)
+		if len(posting) == 0 {
+			delete(m.postings, term)
+		}
+	}
+}
+
+// Search returns a page of the documents that contain every term of the query, allowing
+// for typos and for the terms to be the start of a word
+func (m *MemoryIndex) Search(query *SearchQuery, page *PageRequest) ([]SearchHit, *PageInfo, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	scores := make(map[uint]float64)
+	terms := tokenize(query.Text)
+	if len(terms) == 0 {
+		for id := range m.docs {
+			scores[id] = 0
+		}
+	}
+
+	for i, term := range terms {
+		termScores := m.scoreTerm(term)
+		if i == 0 {
+			scores = termScores
+			continue
+		}
+
+		for id := range scores {
+			if score, ok := termScores[id]; ok {
+				scores[id] += score
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	hits := make([]SearchHit, 0, len(scores))
+	for id, score := range scores {
+		doc := m.docs[id]
+		if matchesFilters(doc, query) {
+			hits = append(hits, SearchHit{SearchDocument: *doc, Score: score})
+		}
+	}
+
+	return pageHits(hits, page)
+}
+
+// pageHits sorts the hits and cuts out a page the way findPage does with rows, the cursor
+// holds the sort value and the quiz id of the last hit of the page
+func pageHits(hits []SearchHit, page *PageRequest) ([]SearchHit, *PageInfo, error) {
+	if page == nil {
+		page = &PageRequest{}
+	}
+
+	limit := pageLimit(page)
+	sortName := page.Sort
+	if sortName == "" {
+		sortName = SortRelevance
+	}
+	order, ok := searchSorts[sortName]
+	if !ok {
+		return nil, nil, fmt.Errorf("search results cannot be sorted by %s", sortName)
+	}
+
+	direction := page.Direction
+	if direction == "" {
+		direction = order.direction
+	}
+
+	sortHits(hits, sortName, direction)
+	total := int64(len(hits))
+
+	if page.Cursor != "" {
+		cursor, err := decodeCursor(page.Cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cursor.Sort != sortName || cursor.Direction != direction {
+			return nil, nil, ErrCursorMoved
+		}
+
+		// A zero value is left out of the cursor
+		value, ok := cursor.Value.(float64)
+		if !ok && cursor.Value != nil {
+			return nil, nil, ErrInvalidCursor
+		}
+
+		start := sort.Search(len(hits), func(i int) bool {
+			return hitBefore(value, cursor.Id, order.value(&hits[i]), hits[i].QuizId, direction)
+		})
+		hits = hits[start:]
+	}
+
+	info := PageInfo{Total: total}
+	if len(hits) > limit {
+		hits = hits[:limit]
+
+		last := &hits[len(hits)-1]
+		info.NextCursor = encodeCursor(pageCursor{Sort: sortName, Direction: direction, Value: order.value(last), Id: last.QuizId})
+	}
+
+	return hits, &info, nil
+}
+
+// scoreTerm finds the indexed terms close to the query term and scores every quiz by its
+// best match. Query terms found in few quizzes count more than common ones, the rarity is
+// that of the query term so a rare near miss never beats an exact match
+func (m *MemoryIndex) scoreTerm(term string) map[uint]float64 {
+	scores := make(map[uint]float64)
+	maxEdits := allowedEdits(term)
+
+	for indexed, posting := range m.postings {
+		match := 0.0
+		if distance := editDistance(term, indexed, maxEdits); distance <= maxEdits {
+			match = 1 / float64(1+distance)
+		} else if len([]rune(term)) >= 3 && strings.HasPrefix(indexed, term) {
+			match = prefixMatchWeight
+		}
+		if match == 0 {
+			continue
+		}
+
+		for id, weight := range posting {
+			if score := weight * match; score > scores[id] {
+				scores[id] = score
+			}
+		}
+	}
+
+	idf := math.Log(1 + float64(len(m.docs))/float64(max(len(scores), 1)))
+	for id := range scores {
+		scores[id] *= idf
+	}
+
+	return scores
+}
+
+func matchesFilters(doc *SearchDocument, query *SearchQuery) bool {
+	if query.MinPrice != nil && doc.Price < *query.MinPrice {
+		return false
+	}
+	if query.MaxPrice != nil && doc.Price > *query.MaxPrice {
+		return false
+	}
+	if doc.Rating < query.MinRating {
+		return false
+	}
+	if query.Difficulty != "" && doc.Difficulty != query.Difficulty {
+		return false
+	}
+	if query.Language != "" && doc.Language != query.Language {
+		return false
+	}
+
+	if len(query.CategoryIds) > 0 {
+		if doc.CategoryId == nil {
+			return false
+		}
+		for _, id := range query.CategoryIds {
+			if id == *doc.CategoryId {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// sortHits orders the hits by one of searchSorts, equal values fall back to the quiz id
+func sortHits(hits []SearchHit, sortName string, direction string) {
+	value := searchSorts[sortName].value
+
+	sort.Slice(hits, func(i, j int) bool {
+		return hitBefore(value(&hits[i]), hits[i].QuizId, value(&hits[j]), hits[j].QuizId, direction)
+	})
+}
+
+// hitBefore reports whether a hit with value a and quiz id aId is sorted before one with
+// value b and quiz id bId
+func hitBefore(a float64, aId uint, b float64, bId uint, direction string) bool {
+	if a != b {
+		if direction == SortDesc {
+			return a > b
+		}
+		return a < b
+	}
+
+	return aId < bId
+}
+
+// tokenize splits text into lower case words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// allowedEdits is how many typos a term may have, short terms have to match exactly
+func allowedEdits(term string) int {
+	switch length := len([]rune(term)); {
+	case length < 4:
+		return 0
+	case length < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance counts the insertions, deletions, substitutions and swaps of neighbouring
+// letters between a and b. It gives up with limit+1 once the distance is known to be larger
+func editDistance(a string, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > limit || -diff > limit {
+		return limit + 1
+	}
+
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, curr[j])
+		}
+
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+
+	return prev[len(rb)]
+}
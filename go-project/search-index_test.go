@@ -0,0 +1,259 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"Capitals", []string{"capitals"}},
+		{"World War II: 1939-1945", []string{"world", "war", "ii", "1939", "1945"}},
+		{"rock'n'roll", []string{"rock", "n", "roll"}},
+		{"Ökologie & Straße", []string{"ökologie", "straße"}},
+	}
+
+	for _, test := range tests {
+		got := tokenize(test.text)
+		if len(got) == 0 && len(test.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestAllowedEdits(t *testing.T) {
+	tests := []struct {
+		term string
+		want int
+	}{
+		{"", 0},
+		{"cat", 0},
+		{"quiz", 1},
+		{"history", 1},
+		{"capitals", 2},
+		{"geography", 2},
+		// Letters are counted, not bytes
+		{"äöü", 0},
+		{"äöüß", 1},
+	}
+
+	for _, test := range tests {
+		if got := allowedEdits(test.term); got != test.want {
+			t.Errorf("allowedEdits(%q) = %d, want %d", test.term, got, test.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"quiz", "quiz", 2, 0},
+		{"", "", 2, 0},
+		{"", "ab", 2, 2},
+		{"quiz", "quix", 2, 1},
+		{"quiz", "quizz", 2, 1},
+		{"quiz", "qui", 2, 1},
+		{"quiz", "qiuz", 2, 1},
+		{"ab", "ba", 2, 1},
+		{"capitals", "cpaitasl", 2, 2},
+		{"history", "hsitroy", 3, 2},
+		// A swapped pair cannot be edited again, so this takes three edits
+		{"ca", "abc", 3, 3},
+		{"café", "cafe", 2, 1},
+		{"straße", "strasse", 2, 2},
+		// Beyond the limit the result is limit+1
+		{"quiz", "quest", 1, 2},
+		{"geography", "biology", 2, 3},
+		{"a", "abcdef", 2, 3},
+		{"kitten", "sitting", 3, 3},
+		{"kitten", "sitting", 2, 3},
+	}
+
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b, test.limit); got != test.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", test.a, test.b, test.limit, got, test.want)
+		}
+		if got := editDistance(test.b, test.a, test.limit); got != test.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", test.b, test.a, test.limit, got, test.want)
+		}
+	}
+}
+
+func TestScoreTerm(t *testing.T) {
+	index := NewMemoryIndex()
+	index.Index(SearchDocument{QuizId: 1, Name: "Capitals"})
+	index.Index(SearchDocument{QuizId: 2, Name: "Capitols"})
+	index.Index(SearchDocument{QuizId: 3, Name: "Capitalism"})
+	index.Index(SearchDocument{QuizId: 4, Name: "Cat"})
+	index.Index(SearchDocument{QuizId: 5, Name: "Cars", Questions: []string{"capitals"}})
+
+	tests := []struct {
+		term    string
+		matches []uint
+	}{
+		// Exact match in the name first, then one typo, two typos and the question last
+		{"capitals", []uint{1, 2, 3, 5}},
+		// Short terms have to match exactly and are not used as prefixes
+		{"cat", []uint{4}},
+		{"car", []uint{5}},
+		{"ca", nil},
+		// Equal scores fall back to the quiz id
+		{"capit", []uint{1, 2, 3, 5}},
+	}
+
+	for _, test := range tests {
+		scores := index.scoreTerm(test.term)
+
+		hits := make([]SearchHit, 0, len(scores))
+		for id, score := range scores {
+			hits = append(hits, SearchHit{SearchDocument: SearchDocument{QuizId: id}, Score: score})
+		}
+		sortHits(hits, SortRelevance, SortDesc)
+
+		var got []uint
+		for _, hit := range hits {
+			got = append(got, hit.QuizId)
+		}
+		if !reflect.DeepEqual(got, test.matches) {
+			t.Errorf("scoreTerm(%q) ranks %v, want %v (scores %v)", test.term, got, test.matches, scores)
+		}
+	}
+}
+
+func TestScoreTermRanking(t *testing.T) {
+	index := NewMemoryIndex()
+	index.Index(SearchDocument{QuizId: 1, Name: "Rivers"})
+	index.Index(SearchDocument{QuizId: 2, Description: "rivers"})
+	index.Index(SearchDocument{QuizId: 3, Name: "Rivres"})
+	index.Index(SearchDocument{QuizId: 4, Name: "Riversides"})
+
+	// A rare word that only starts with the term must not beat the exact match
+	scores := index.scoreTerm("rivers")
+	if !(scores[1] > scores[4] && scores[4] > scores[3]) {
+		t.Errorf("exact match should beat a prefix and a prefix a typo, got %v", scores)
+	}
+	if !(scores[1] > scores[2]) {
+		t.Errorf("a match in the name should beat one in the description, got %v", scores)
+	}
+
+	// A term more quizzes have is worth less
+	rare := NewMemoryIndex()
+	rare.Index(SearchDocument{QuizId: 1, Name: "Rivers"})
+	rare.Index(SearchDocument{QuizId: 2, Name: "Lakes"})
+	before := rare.scoreTerm("rivers")[1]
+	rare.Index(SearchDocument{QuizId: 3, Name: "Rivers"})
+	if after := rare.scoreTerm("rivers")[1]; after >= before {
+		t.Errorf("more common term should score less, got %v then %v", before, after)
+	}
+}
+
+func TestSortHits(t *testing.T) {
+	hits := func() []SearchHit {
+		return []SearchHit{
+			{SearchDocument: SearchDocument{QuizId: 1, ProductId: 10, Price: 5, Rating: 4}, Score: 1},
+			{SearchDocument: SearchDocument{QuizId: 2, ProductId: 30, Price: 2, Rating: 4}, Score: 3},
+			{SearchDocument: SearchDocument{QuizId: 3, ProductId: 20, Price: 5, Rating: 5}, Score: 3},
+			{SearchDocument: SearchDocument{QuizId: 4, ProductId: 40, Price: 9, Rating: 1}, Score: 1},
+		}
+	}
+
+	tests := []struct {
+		sort      string
+		direction string
+		want      []uint
+	}{
+		// Equal values fall back to the quiz id in both directions
+		{SortRelevance, SortDesc, []uint{2, 3, 1, 4}},
+		{SortRelevance, SortAsc, []uint{1, 4, 2, 3}},
+		{SortPrice, SortAsc, []uint{2, 1, 3, 4}},
+		{SortPrice, SortDesc, []uint{4, 1, 3, 2}},
+		{SortRating, SortDesc, []uint{3, 1, 2, 4}},
+		{SortNewest, SortDesc, []uint{4, 2, 3, 1}},
+	}
+
+	for _, test := range tests {
+		sorted := hits()
+		sortHits(sorted, test.sort, test.direction)
+
+		var got []uint
+		for _, hit := range sorted {
+			got = append(got, hit.QuizId)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("sortHits(%q, %q) = %v, want %v", test.sort, test.direction, got, test.want)
+		}
+	}
+}
+
+func TestPageHits(t *testing.T) {
+	hits := func() []SearchHit {
+		return []SearchHit{
+			{SearchDocument: SearchDocument{QuizId: 1, ProductId: 10, Price: 9.99}},
+			{SearchDocument: SearchDocument{QuizId: 2, ProductId: 20, Price: 0.1}},
+			{SearchDocument: SearchDocument{QuizId: 3, ProductId: 30, Price: 9.99}},
+			{SearchDocument: SearchDocument{QuizId: 4, ProductId: 40, Price: 0.1}},
+			{SearchDocument: SearchDocument{QuizId: 5, ProductId: 50, Price: 4.5}},
+		}
+	}
+
+	tests := []struct {
+		sort      string
+		direction string
+		want      []uint
+	}{
+		// Without a query every score is zero, which is left out of the cursor
+		{"", "", []uint{1, 2, 3, 4, 5}},
+		{SortPrice, "", []uint{2, 4, 5, 1, 3}},
+		{SortPrice, SortDesc, []uint{1, 3, 5, 2, 4}},
+		{SortNewest, "", []uint{5, 4, 3, 2, 1}},
+	}
+
+	for _, test := range tests {
+		page := PageRequest{Limit: 2, Sort: test.sort, Direction: test.direction}
+
+		var got []uint
+		for pages := 0; pages < 5; pages++ {
+			result, info, err := pageHits(hits(), &page)
+			if err != nil {
+				t.Fatalf("sort %q %q: %v", test.sort, test.direction, err)
+			}
+			if info.Total != 5 {
+				t.Errorf("sort %q %q: total = %d, want 5", test.sort, test.direction, info.Total)
+			}
+
+			for _, hit := range result {
+				got = append(got, hit.QuizId)
+			}
+			if info.NextCursor == "" {
+				break
+			}
+			page.Cursor = info.NextCursor
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("pages sorted by %q %q = %v, want %v", test.sort, test.direction, got, test.want)
+		}
+	}
+
+	_, info, err := pageHits(hits(), &PageRequest{Limit: 2, Sort: SortPrice})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := pageHits(hits(), &PageRequest{Limit: 2, Sort: SortNewest, Cursor: info.NextCursor}); err != ErrCursorMoved {
+		t.Errorf("cursor of another sort = %v, want ErrCursorMoved", err)
+	}
+	if _, _, err := pageHits(hits(), &PageRequest{Sort: "name"}); err == nil {
+		t.Errorf("unknown sort was accepted")
+	}
+}
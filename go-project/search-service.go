@@ -0,0 +1,137 @@
+package main
+
+import (
+	"log"
+)
+
+// RebuildSearchIndex indexes every quiz that is for sale. A quiz that cannot be indexed
+// is left out of the search instead of keeping the server from starting
+func RebuildSearchIndex() error {
+	page := PageRequest{Limit: maxPageLimit}
+	count := 0
+	for {
+		products, info, err := Db.GetProductsForSale(&ProductFilter{}, nil, &page)
+		if err != nil {
+			return err
+		}
+
+		for _, product := range products {
+			if err := indexQuiz(product.ItemId); err != nil {
+				log.Printf("failed to index quiz %d: %v", product.ItemId, err)
+				continue
+			}
+			count++
+		}
+
+		if info.NextCursor == "" {
+			break
+		}
+		page.Cursor = info.NextCursor
+	}
+
+	log.Printf("indexed %d quizzes for search", count)
+	return nil
+}
+
+// reindexQuiz updates the quiz in the search index after it changed. The change is
+// already saved and the index is rebuilt from the database on the next start, so the
+// caller is not failed when only the index is behind
+func reindexQuiz(quizId uint) {
+	if Search == nil {
+		return
+	}
+
+	if err := indexQuiz(quizId); err != nil {
+		log.Printf("failed to index quiz %d: %v", quizId, err)
+	}
+}
+
+func reindexProduct(productId uint) {
+	product, err := Db.GetProductById(productId)
+	if err != nil {
+		log.Printf("failed to index product %d: %v", productId, err)
+		return
+	}
+
+	reindexQuiz(product.ItemId)
+}
+
+// reindexQuizzesOfOwner updates the quizzes of a renamed account, they can be found by
+// the name of their owner
+func reindexQuizzesOfOwner(ownerId uint) {
+	if Search == nil {
+		return
+	}
+
+	ids, err := Db.GetQuizIdsByOwnerId(ownerId)
+	if err != nil {
+		log.Printf("failed to index quizzes of account %d: %v", ownerId, err)
+		return
+	}
+
+	for _, id := range ids {
+		reindexQuiz(id)
+	}
+}
+
+// indexQuiz adds a published quiz that is for sale to the index and removes any other
+func indexQuiz(quizId uint) error {
+	product, err := Db.GetProductByQuizId(quizId)
+	if err != nil || product.Item.Status != QuizPublished {
+		return Search.Remove(quizId)
+	}
+
+	quiz := &product.Item
+	revision, err := Db.GetQuizRevision(quiz.Id, quiz.LatestRevision)
+	if err != nil {
+		return err
+	}
+
+	questions := make([]string, 0, len(revision.Questions))
+	for _, question := range revision.Questions {
+		questions = append(questions, question.Text)
+	}
+
+	// The listing shows the content buyers get, so name and description come from the
+	// latest revision while the metadata is the current one
+	return Search.Index(SearchDocument{
+		QuizId:      quiz.Id,
+		ProductId:   product.Id,
+		Name:        revision.Name,
+		Description: revision.Description,
+		Owner:       quiz.Owner.Username,
+		Tags:        tagNames(quiz.Tags),
+		Questions:   questions,
+		CategoryId:  quiz.CategoryId,
+		Difficulty:  quiz.Difficulty,
+		Language:    quiz.Language,
+		Price:       product.Price,
+		Rating:      averageRating(product.Ratings),
+	})
+}
+
+// SearchQuizzes searches the marketplace, a category matches its subcategories too
+func SearchQuizzes(query *SearchQuery, categoryId uint, page *PageRequest) ([]SearchHit, *PageInfo, error) {
+	if categoryId != 0 {
+		ids, err := categoryWithDescendants(categoryId)
+		if err != nil {
+			return nil, nil, err
+		}
+		query.CategoryIds = ids
+	}
+
+	return Search.Search(query, page)
+}
+
+func averageRating(ratings []Rating) float64 {
+	if len(ratings) == 0 {
+		return 0
+	}
+
+	sum := 0
+	for _, rating := range ratings {
+		sum += int(rating.Value)
+	}
+
+	return float64(sum) / float64(len(ratings))
+}
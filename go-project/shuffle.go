@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+)
+
+// Answer orders a game can be created with
+const (
+	AnswerOrderStored = ""
+	AnswerOrderGlobal = "global"
+	AnswerOrderPlayer = "player"
+)
+
+// seedMultipliers spread question and player ids over the seed so neighbouring ids do not
+// produce similar orders
+const (
+	questionSeedMultiplier = 1000003
+	playerSeedMultiplier   = 7919
+)
+
+// validateGameOptions checks the shuffle options of a new game against its quiz
+func validateGameOptions(body *CreateGameRequest, questionCount int) error {
+	switch body.AnswerOrder {
+	case AnswerOrderStored, AnswerOrderGlobal, AnswerOrderPlayer:
+	default:
+		return errors.New("answer order must be empty, global or player")
+	}
+
+	if int(body.QuestionCount) > questionCount {
+		return errors.New("quiz does not have that many questions")
+	}
+
+	return nil
+}
+
+// arrangeQuestions puts the questions of the game in the order they will be played and
+// keeps only the drawn subset. The order only depends on the seed of the game, so it is
+// the same when a game is resumed and can be reproduced afterwards
+func arrangeQuestions(game *Game) {
+	questions := game.Revision.Questions
+	random := rand.New(rand.NewSource(game.Seed))
+
+	if game.ShuffleQuestions || game.QuestionCount > 0 {
+		random.Shuffle(len(questions), func(i, j int) {
+			questions[i], questions[j] = questions[j], questions[i]
+		})
+	}
+
+	if game.QuestionCount > 0 && int(game.QuestionCount) < len(questions) {
+		questions = questions[:game.QuestionCount]
+	}
+
+	// A drawn subset that should not be shuffled is played in the stored order
+	if !game.ShuffleQuestions {
+		sort.Slice(questions, func(i, j int) bool {
+			return questions[i].Id < questions[j].Id
+		})
+	}
+
+	game.Revision.Questions = questions
+}
+
+// CreateQuestionDtoForPlayer creates the question as the player sees it, in their language
+// and with the answers in the order picked by the game
+func CreateQuestionDtoForPlayer(game *Game, question Question, playerId uint, language string) *QuestionDto {
+	dto := CreateQuestionDtoInLanguage(question, language)
+
+	seed := game.Seed + int64(question.Id)*questionSeedMultiplier
+	switch game.AnswerOrder {
+	case AnswerOrderGlobal:
+	case AnswerOrderPlayer:
+		seed += int64(playerId) * playerSeedMultiplier
+	default:
+		return dto
+	}
+
+	random := rand.New(rand.NewSource(seed))
+	random.Shuffle(len(dto.Answers), func(i, j int) {
+		dto.Answers[i], dto.Answers[j] = dto.Answers[j], dto.Answers[i]
+	})
+
+	return dto
+}
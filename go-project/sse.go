@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ServeSSE streams the events of a game as Server-Sent Events. It is the fallback for
+// networks that block websocket upgrades, the client is registered with the manager like
+// a websocket one so both kinds of players can share a game
+func (m *Manager) ServeSSE(w http.ResponseWriter, r *http.Request, gameCode string, userId uint) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	client := NewClient(nil, userId, gameCode)
+	m.addClient(client)
+	defer m.removeClient(client)
+
+	HelloSend(client)
+
+	// Comments keep proxies from closing an idle stream
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message, ok := <-client.egress:
+			if !ok {
+				return
+			}
+
+			data, err := message.Encode(EncodingJSON)
+			if err != nil {
+				log.Println(err)
+				return
+			}
+
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", message.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// SubmitEvent handles an event sent over REST by a player that is not on a websocket. It
+// goes through the same handlers as websocket events
+func (m *Manager) SubmitEvent(gameCode string, userId uint, event Event) error {
+	return m.routeEvent(event, NewClient(nil, userId, gameCode))
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"time"
+
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -10,12 +13,12 @@ import (
 type Storage interface {
 	DeleteRatingById(id uint) error
 	GetRatingById(id uint) (*Rating, error)
-	GetRatingsByProductId(id uint) ([]Rating, error)
+	GetRatingsByProductId(id uint, page *PageRequest) ([]Rating, *PageInfo, error)
 	PostRating(rating *Rating) error
 
 	DeleteCommentById(id uint) error
 	GetCommentById(id uint) (*Comment, error)
-	GetCommentsByProductId(id uint) ([]Comment, error)
+	GetCommentsByProductId(id uint, page *PageRequest) ([]Comment, *PageInfo, error)
 	PostComment(comment *Comment) error
 
 	GetAnswersByQuestionId(questionId int) ([]Answer, error)
@@ -34,24 +37,155 @@ type Storage interface {
 	PutAccount(account *Account) error
 	GetAccountById(id uint) (*Account, error)
 	GetAccountByUsername(username string) (*Account, error)
+	GetIdleBotAccounts(limit int) ([]Account, error)
 
-	GetProducts() ([]Product, error)
+	GetProducts(page *PageRequest) ([]Product, *PageInfo, error)
+	GetProductByQuizId(quizId uint) (*Product, error)
+	GetProductsForSale(filter *ProductFilter, categoryIds []uint, page *PageRequest) ([]Product, *PageInfo, error)
 	GetProductById(id uint) (*Product, error)
 	PutProduct(product *Product) error
 	DeleteProductById(id int) error
 	IsQuizForSale(quizId uint) (bool, error)
 
 	GetQuizById(id uint) (*Quiz, error)
-	GetQuizzesByOwnerId(id int) ([]Quiz, error)
+	GetQuizWithQuestions(id uint) (*Quiz, error)
+	GetQuizzesByOwnerId(id uint, publishedOnly bool, page *PageRequest) ([]Quiz, *PageInfo, error)
+	GetQuizIdsByOwnerId(id uint) ([]uint, error)
 	PutQuiz(quiz *Quiz) error
 	PostQuiz(quiz *Quiz) error
+	PutQuizWithQuestions(quiz *Quiz) error
+	UpdateQuizStatus(id uint, status string) error
 	DeleteQuizById(id int) error
 
+	PostQuizRevision(revision *QuizRevision) error
+	GetQuizRevision(quizId uint, number uint) (*QuizRevision, error)
+	GetQuizRevisions(quizId uint, page *PageRequest) ([]QuizRevision, *PageInfo, error)
+
+	PostPurchase(purchase *Purchase, price float32, sellerId uint) error
+	PutPurchase(purchase *Purchase) error
+	GetPurchase(accountId uint, quizId uint) (*Purchase, error)
+	GetPurchasesByAccountId(accountId uint, page *PageRequest) ([]Purchase, *PageInfo, error)
+
 	GetGameById(id uint) (*Game, error)
 	SaveGame(game *Game) error
 	GetGameByCode(code string) (*Game, error)
+	GetOrphanedGames() ([]Game, error)
+	GetExpiredLobbies(createdBefore time.Time) ([]Game, error)
+	DeleteStat(gameId uint, playerId uint) error
+	SetAccountsInGame(ids []uint, isInGame bool) error
+	ClearInGameFlags(exceptIds []uint) error
+
+	GetCategories() ([]Category, error)
+	GetCategoryById(id uint) (*Category, error)
+	PostCategory(category *Category) error
+	PutCategory(category *Category) error
+	DeleteCategoryById(id uint) error
+	IsCategoryInUse(id uint) (bool, error)
+	GetOrCreateTags(names []string) ([]Tag, error)
+
+	PostMedia(media *Media) error
+	GetMediaByKey(key string) (*Media, error)
+	GetMediaByIds(ids []uint) ([]Media, error)
+
+	GetQuizCollaborator(quizId uint, accountId uint) (*QuizCollaborator, error)
+	GetQuizCollaborators(quizId uint) ([]QuizCollaborator, error)
+	PutQuizCollaborator(collaborator *QuizCollaborator) error
+	DeleteQuizCollaborator(quizId uint, accountId uint) error
+	UnlinkBankQuestions(quizId uint, ownerId uint) error
+	PostQuizActivities(activities []QuizActivity) error
+	GetQuizActivities(quizId uint, page *PageRequest) ([]QuizActivity, *PageInfo, error)
+
+	PostBankQuestion(question *BankQuestion) error
+	PutBankQuestion(question *BankQuestion) error
+	GetBankQuestionById(id uint) (*BankQuestion, error)
+	GetBankQuestionsByIds(ids []uint) ([]BankQuestion, error)
+	GetBankQuestions(ownerId uint, filter *BankFilter, page *PageRequest) ([]BankQuestion, *PageInfo, error)
+	GetBankQuestionIds(ownerId uint, filter *BankFilter) ([]uint, error)
+	DeleteBankQuestionById(id uint) error
+
+	PostAnswerAudit(audit *AnswerAudit) error
+	PutAnswerAudit(audit *AnswerAudit) error
+	GetAnswerAuditById(id uint) (*AnswerAudit, error)
+	GetAnswerAudits(includeReviewed bool, page *PageRequest) ([]AnswerAudit, *PageInfo, error)
+
+	PostGameAnswer(answer *GameAnswer) error
+	GetGameAnswersByGameIds(ids []uint) ([]GameAnswer, error)
+	GetPlayedGamesByRevisionId(revisionId uint) ([]Game, error)
+
+	Close() error
 }
 
+// priceSortColumn compares prices as cents, a FLOAT column never equals the cursor of a
+// price like 9.99 so rows with the same price would be skipped or repeated between pages
+const priceSortColumn = "CAST(price AS DECIMAL(12,2))"
+
+// Sorts every list can be paged by, see findPage
+var (
+	productPages = pageSpec[Product]{
+		sorts: map[string]sortColumn[Product]{
+			"id":    {"id", func(p *Product) interface{} { return p.Id }},
+			"price": {priceSortColumn, func(p *Product) interface{} { return priceCursor(p.Price) }},
+		},
+		id: func(p *Product) uint { return p.Id },
+	}
+	commentPages = pageSpec[Comment]{
+		sorts: map[string]sortColumn[Comment]{
+			"id": {"id", func(c *Comment) interface{} { return c.Id }},
+		},
+		id: func(c *Comment) uint { return c.Id },
+	}
+	ratingPages = pageSpec[Rating]{
+		sorts: map[string]sortColumn[Rating]{
+			"id":    {"id", func(r *Rating) interface{} { return r.Id }},
+			"value": {"value", func(r *Rating) interface{} { return r.Value }},
+		},
+		id: func(r *Rating) uint { return r.Id },
+	}
+	quizPages = pageSpec[Quiz]{
+		sorts: map[string]sortColumn[Quiz]{
+			"id":   {"id", func(q *Quiz) interface{} { return q.Id }},
+			"name": {"name", func(q *Quiz) interface{} { return q.Name }},
+		},
+		id: func(q *Quiz) uint { return q.Id },
+	}
+	revisionPages = pageSpec[QuizRevision]{
+		sorts: map[string]sortColumn[QuizRevision]{
+			"id":     {"id", func(r *QuizRevision) interface{} { return r.Id }},
+			"number": {"number", func(r *QuizRevision) interface{} { return r.Number }},
+		},
+		id: func(r *QuizRevision) uint { return r.Id },
+	}
+	purchasePages = pageSpec[Purchase]{
+		sorts: map[string]sortColumn[Purchase]{
+			"id":        {"id", func(p *Purchase) interface{} { return p.Id }},
+			"createdAt": {"created_at", func(p *Purchase) interface{} { return timeCursor(p.CreatedAt) }},
+		},
+		id: func(p *Purchase) uint { return p.Id },
+	}
+	bankQuestionPages = pageSpec[BankQuestion]{
+		sorts: map[string]sortColumn[BankQuestion]{
+			"id":        {"id", func(q *BankQuestion) interface{} { return q.Id }},
+			"createdAt": {"created_at", func(q *BankQuestion) interface{} { return timeCursor(q.CreatedAt) }},
+		},
+		id: func(q *BankQuestion) uint { return q.Id },
+	}
+	activityPages = pageSpec[QuizActivity]{
+		sorts: map[string]sortColumn[QuizActivity]{
+			"id": {"id", func(a *QuizActivity) interface{} { return a.Id }},
+		},
+		id:        func(a *QuizActivity) uint { return a.Id },
+		direction: SortDesc,
+	}
+	auditPages = pageSpec[AnswerAudit]{
+		sorts: map[string]sortColumn[AnswerAudit]{
+			"id":        {"id", func(a *AnswerAudit) interface{} { return a.Id }},
+			"createdAt": {"created_at", func(a *AnswerAudit) interface{} { return timeCursor(a.CreatedAt) }},
+		},
+		id:        func(a *AnswerAudit) uint { return a.Id },
+		direction: SortDesc,
+	}
+)
+
 type MySqlStore struct {
 	db *gorm.DB
 }
@@ -79,13 +213,82 @@ func (s *MySqlStore) GetGameById(id uint) (*Game, error) {
 func (s *MySqlStore) GetGameByCode(code string) (*Game, error) {
 	var game Game
 
-	if err := s.db.Where("code = ?", code).Error; err != nil {
+	if err := preloadGame(s.db).Where("active_code = ?", code).First(&game).Error; err != nil {
 		return nil, err
 	}
 
 	return &game, nil
 }
 
+// preloadGame loads everything a game needs to be played
+func preloadGame(db *gorm.DB) *gorm.DB {
+	byId := func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}
+
+	return db.Preload("Stats.Player").
+		Preload("ActiveQuiz").
+		Preload("Revision.Questions", byId).
+		Preload("Revision.Questions.Media").
+		Preload("Revision.Questions.Answers", byId).
+		Preload("Revision.Questions.Answers.Media")
+}
+
+func (s *MySqlStore) GetOrphanedGames() ([]Game, error) {
+	var games []Game
+
+	if err := preloadGame(s.db).Where("is_active = ?", true).Find(&games).Error; err != nil {
+		return nil, err
+	}
+
+	return games, nil
+}
+
+func (s *MySqlStore) GetExpiredLobbies(createdBefore time.Time) ([]Game, error) {
+	var games []Game
+
+	if err := s.db.Preload("Stats").
+		Where("active_code IS NOT NULL AND is_in_progress = ? AND created_at < ?", false, createdBefore).
+		Find(&games).Error; err != nil {
+		return nil, err
+	}
+
+	return games, nil
+}
+
+func (s *MySqlStore) DeleteStat(gameId uint, playerId uint) error {
+	if err := s.db.Where("game_id = ? AND player_id = ?", gameId, playerId).Delete(&Stat{}).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *MySqlStore) SetAccountsInGame(ids []uint, isInGame bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := s.db.Model(&Account{}).Where("id IN ?", ids).Update("is_in_game", isInGame).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *MySqlStore) ClearInGameFlags(exceptIds []uint) error {
+	query := s.db.Model(&Account{}).Where("is_in_game = ?", true)
+	if len(exceptIds) > 0 {
+		query = query.Where("id NOT IN ?", exceptIds)
+	}
+
+	if err := query.Update("is_in_game", false).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (s *MySqlStore) GetRatingById(id uint) (*Rating, error) {
 	var rating Rating
 
@@ -104,14 +307,8 @@ func (s *MySqlStore) DeleteRatingById(id uint) error {
 	return nil
 }
 
-func (s *MySqlStore) GetRatingsByProductId(id uint) ([]Rating, error) {
-	var ratings []Rating
-
-	if err := s.db.Where("corresponding_product_id = ?", id).Find(&ratings).Error; err != nil {
-		return nil, err
-	}
-
-	return ratings, nil
+func (s *MySqlStore) GetRatingsByProductId(id uint, page *PageRequest) ([]Rating, *PageInfo, error) {
+	return findPage(s.db.Where("corresponding_product_id = ?", id), page, ratingPages)
 }
 
 func (s *MySqlStore) PostRating(rating *Rating) error {
@@ -150,14 +347,8 @@ func (s *MySqlStore) DeleteCommentById(id uint) error {
 	return nil
 }
 
-func (s *MySqlStore) GetCommentsByProductId(id uint) ([]Comment, error) {
-	var comments []Comment
-
-	if err := s.db.Where("corresponding_product_id = ?", id).Find(&comments).Error; err != nil {
-		return nil, err
-	}
-
-	return comments, nil
+func (s *MySqlStore) GetCommentsByProductId(id uint, page *PageRequest) ([]Comment, *PageInfo, error) {
+	return findPage(s.db.Where("corresponding_product_id = ?", id), page, commentPages)
 }
 
 func (s *MySqlStore) PostComment(comment *Comment) error {
@@ -231,7 +422,7 @@ func (s *MySqlStore) PutQuestion(question *Question) error {
 func (s *MySqlStore) GetQuestionsByQuizId(quizId int) ([]Question, error) {
 	var questions []Question
 
-	if err := s.db.Where("corresponding_quiz_id = ?", quizId).Find(&questions).Error; err != nil {
+	if err := s.db.Where("corresponding_quiz_id = ? AND revision_id IS NULL", quizId).Find(&questions).Error; err != nil {
 		return nil, err
 	}
 
@@ -283,13 +474,52 @@ func (s *MySqlStore) GetAccountByUsername(username string) (*Account, error) {
 	return &account, nil
 }
 
-func (s *MySqlStore) GetProducts() ([]Product, error) {
-	var products []Product
-	if err := s.db.Find(&products).Error; err != nil {
+func (s *MySqlStore) GetIdleBotAccounts(limit int) ([]Account, error) {
+	var accounts []Account
+
+	if err := s.db.Where("role = ? AND is_in_game = ?", Buser, false).Limit(limit).Find(&accounts).Error; err != nil {
 		return nil, err
 	}
 
-	return products, nil
+	return accounts, nil
+}
+
+func (s *MySqlStore) GetProducts(page *PageRequest) ([]Product, *PageInfo, error) {
+	return findPage(s.db, page, productPages)
+}
+
+func (s *MySqlStore) GetProductsForSale(filter *ProductFilter, categoryIds []uint, page *PageRequest) ([]Product, *PageInfo, error) {
+	quizzes := s.db.Model(&Quiz{}).Select("id").Where("status = ?", QuizPublished)
+	if len(categoryIds) > 0 {
+		quizzes = quizzes.Where("category_id IN ?", categoryIds)
+	}
+	if filter.Difficulty != "" {
+		quizzes = quizzes.Where("difficulty = ?", filter.Difficulty)
+	}
+	if filter.Language != "" {
+		quizzes = quizzes.Where("language = ?", filter.Language)
+	}
+	if len(filter.Tags) > 0 {
+		tagged := s.db.Table("quiz_tags").Select("quiz_tags.quiz_id").
+			Joins("JOIN tags ON tags.id = quiz_tags.tag_id").
+			Where("tags.name IN ?", filter.Tags).
+			Group("quiz_tags.quiz_id").
+			Having("COUNT(DISTINCT tags.id) = ?", len(filter.Tags))
+		quizzes = quizzes.Where("id IN (?)", tagged)
+	}
+
+	return findPage(s.db.Where("item_id IN (?)", quizzes), page, productPages, "Item.Owner", "Item.Category", "Item.Tags")
+}
+
+func (s *MySqlStore) GetProductByQuizId(quizId uint) (*Product, error) {
+	var product Product
+
+	if err := s.db.Preload("Item.Owner").Preload("Item.Tags").Preload("Ratings").
+		Where("item_id = ?", quizId).First(&product).Error; err != nil {
+		return nil, err
+	}
+
+	return &product, nil
 }
 
 func (s *MySqlStore) GetProductById(id uint) (*Product, error) {
@@ -340,16 +570,42 @@ func (s *MySqlStore) GetQuizById(id uint) (*Quiz, error) {
 	return &quiz, nil
 }
 
-func (s *MySqlStore) GetQuizzesByOwnerId(id int) ([]Quiz, error) {
-	var quizzes []Quiz
+func (s *MySqlStore) GetQuizWithQuestions(id uint) (*Quiz, error) {
+	var quiz Quiz
+
+	workingCopy := func(db *gorm.DB) *gorm.DB {
+		return db.Where("revision_id IS NULL").Order("id")
+	}
+	byId := func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}
 
-	if err := s.db.Where("owner_id = ?", id).Find(&quizzes).Error; err != nil {
+	if err := s.db.Preload("Questions", workingCopy).Preload("Questions.Answers", byId).
+		Preload("Owner").Preload("Category").Preload("Tags").First(&quiz, id).Error; err != nil {
 		return nil, err
 	}
 
-	return quizzes, nil
+	return &quiz, nil
+}
+
+func (s *MySqlStore) GetQuizzesByOwnerId(id uint, publishedOnly bool, page *PageRequest) ([]Quiz, *PageInfo, error) {
+	query := s.db.Where("owner_id = ?", id)
+	if publishedOnly {
+		query = query.Where("status = ?", QuizPublished)
+	}
+
+	return findPage(query, page, quizPages, "Owner", "Category", "Tags")
 }
 
+func (s *MySqlStore) GetQuizIdsByOwnerId(id uint) ([]uint, error) {
+	var ids []uint
+
+	if err := s.db.Model(&Quiz{}).Where("owner_id = ?", id).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
 
 func (s *MySqlStore) PutQuiz(quiz *Quiz) error {
 	if err := s.db.Save(quiz).Error; err != nil {
@@ -367,6 +623,71 @@ func (s *MySqlStore) PostQuiz(quiz *Quiz) error {
 	return nil
 }
 
+// PutQuizWithQuestions saves the editable fields of the quiz and replaces the questions of
+// its working copy, the questions of published revisions are left alone. The status and the
+// latest revision are only changed by UpdateQuizStatus and PostQuizRevision. The save fails
+// with ErrQuizConflict when the quiz is no longer at the version it was loaded with
+func (s *MySqlStore) PutQuizWithQuestions(quiz *Quiz) error {
+	version := quiz.Version
+	quiz.Version++
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(quiz).Where("version = ?", version).
+			Select("name", "description", "translations", "category_id", "difficulty", "language", "version").Updates(quiz)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrQuizConflict
+		}
+
+		if err := tx.Model(quiz).Association("Tags").Replace(quiz.Tags); err != nil {
+			return err
+		}
+
+		var old []Question
+		if err := tx.Where("corresponding_quiz_id = ? AND revision_id IS NULL", quiz.Id).Find(&old).Error; err != nil {
+			return err
+		}
+
+		if len(old) > 0 {
+			if err := tx.Select("Answers").Delete(&old).Error; err != nil {
+				return err
+			}
+		}
+
+		for i := range quiz.Questions {
+			quiz.Questions[i].CorrespondingQuizId = quiz.Id
+			quiz.Questions[i].RevisionId = nil
+		}
+
+		if len(quiz.Questions) > 0 {
+			if err := tx.Create(&quiz.Questions).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		quiz.Version = version
+		return err
+	}
+
+	return nil
+}
+
+// UpdateQuizStatus changes the status and the version, so saves of the working copy that
+// were started under the old status fail
+func (s *MySqlStore) UpdateQuizStatus(id uint, status string) error {
+	if err := s.db.Model(&Quiz{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status": status, "version": gorm.Expr("version + 1")}).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (s *MySqlStore) DeleteQuizById(id int) error {
 	if err := s.db.Where("id = ?", id).Delete(&Quiz{}).Error; err != nil {
 		return err
@@ -375,15 +696,587 @@ func (s *MySqlStore) DeleteQuizById(id int) error {
 	return nil
 }
 
+// PostQuizRevision saves the revision with its questions and makes it the latest one, the
+// version of the quiz changes like on every save
+func (s *MySqlStore) PostQuizRevision(revision *QuizRevision) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(revision).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Quiz{}).Where("id = ?", revision.QuizId).
+			Updates(map[string]interface{}{"latest_revision": revision.Number, "version": gorm.Expr("version + 1")}).Error; err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s *MySqlStore) GetQuizRevision(quizId uint, number uint) (*QuizRevision, error) {
+	var revision QuizRevision
+
+	byId := func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}
+
+	if err := s.db.Preload("Questions", byId).Preload("Questions.Answers", byId).
+		Where("quiz_id = ? AND number = ?", quizId, number).First(&revision).Error; err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+func (s *MySqlStore) GetQuizRevisions(quizId uint, page *PageRequest) ([]QuizRevision, *PageInfo, error) {
+	return findPage(s.db.Where("quiz_id = ?", quizId), page, revisionPages, "Questions")
+}
+
+// PostPurchase saves the purchase and moves the price from the buyer to the seller
+func (s *MySqlStore) PostPurchase(purchase *Purchase, price float32, sellerId uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Quiz", "Revision").Create(purchase).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Account{}).Where("id = ?", purchase.AccountId).
+			Update("balance", gorm.Expr("balance - ?", price)).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Account{}).Where("id = ?", sellerId).
+			Update("balance", gorm.Expr("balance + ?", price)).Error; err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s *MySqlStore) PutPurchase(purchase *Purchase) error {
+	if err := s.db.Omit("Quiz", "Revision").Save(purchase).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *MySqlStore) GetPurchase(accountId uint, quizId uint) (*Purchase, error) {
+	var purchase Purchase
+
+	if err := s.db.Preload("Revision").Where("account_id = ? AND quiz_id = ?", accountId, quizId).First(&purchase).Error; err != nil {
+		return nil, err
+	}
+
+	return &purchase, nil
+}
+
+func (s *MySqlStore) GetPurchasesByAccountId(accountId uint, page *PageRequest) ([]Purchase, *PageInfo, error) {
+	return findPage(s.db.Where("account_id = ?", accountId), page, purchasePages, "Quiz.Owner", "Revision")
+}
+
+func (s *MySqlStore) GetCategories() ([]Category, error) {
+	var categories []Category
+
+	if err := s.db.Order("name").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+func (s *MySqlStore) GetCategoryById(id uint) (*Category, error) {
+	var category Category
+
+	if err := s.db.First(&category, id).Error; err != nil {
+		return nil, err
+	}
+
+	return &category, nil
+}
+
+func (s *MySqlStore) PostCategory(category *Category) error {
+	if err := s.db.Create(category).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *MySqlStore) PutCategory(category *Category) error {
+	if err := s.db.Omit("Parent", "Children").Save(category).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *MySqlStore) DeleteCategoryById(id uint) error {
+	if err := s.db.Where("id = ?", id).Delete(&Category{}).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *MySqlStore) IsCategoryInUse(id uint) (bool, error) {
+	var children, quizzes int64
+
+	if err := s.db.Model(&Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+		return false, err
+	}
+
+	if err := s.db.Model(&Quiz{}).Where("category_id = ?", id).Count(&quizzes).Error; err != nil {
+		return false, err
+	}
+
+	return children > 0 || quizzes > 0, nil
+}
+
+// GetOrCreateTags returns the tags with the names, creating the ones that do not exist
+func (s *MySqlStore) GetOrCreateTags(names []string) ([]Tag, error) {
+	tags := make([]Tag, 0, len(names))
+
+	for _, name := range names {
+		tag := Tag{Name: name}
+		if err := s.db.Where(Tag{Name: name}).FirstOrCreate(&tag).Error; err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+func (s *MySqlStore) PostMedia(media *Media) error {
+	if err := s.db.Create(media).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *MySqlStore) GetMediaByKey(key string) (*Media, error) {
+	var media Media
+
+	if err := s.db.Where("`key` = ?", key).First(&media).Error; err != nil {
+		return nil, err
+	}
+
+	return &media, nil
+}
+
+func (s *MySqlStore) GetMediaByIds(ids []uint) ([]Media, error) {
+	var media []Media
+
+	if err := s.db.Where("id IN ?", ids).Find(&media).Error; err != nil {
+		return nil, err
+	}
+
+	return media, nil
+}
+
+func (s *MySqlStore) GetQuizCollaborator(quizId uint, accountId uint) (*QuizCollaborator, error) {
+	var collaborator QuizCollaborator
+
+	if err := s.db.Where("quiz_id = ? AND account_id = ?", quizId, accountId).First(&collaborator).Error; err != nil {
+		return nil, err
+	}
+
+	return &collaborator, nil
+}
+
+func (s *MySqlStore) GetQuizCollaborators(quizId uint) ([]QuizCollaborator, error) {
+	var collaborators []QuizCollaborator
+
+	if err := s.db.Preload("Account").Where("quiz_id = ?", quizId).Order("id").Find(&collaborators).Error; err != nil {
+		return nil, err
+	}
+
+	return collaborators, nil
+}
+
+// PutQuizCollaborator adds the co-author or changes the role it already has
+func (s *MySqlStore) PutQuizCollaborator(collaborator *QuizCollaborator) error {
+	if err := s.db.Omit("Account").Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"role"}),
+	}).Create(collaborator).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *MySqlStore) DeleteQuizCollaborator(quizId uint, accountId uint) error {
+	result := s.db.Where("quiz_id = ? AND account_id = ?", quizId, accountId).Delete(&QuizCollaborator{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// UnlinkBankQuestions turns the questions of the working copy that refer to the bank of
+// the owner into plain copies, the version is bumped so open editors reload them
+func (s *MySqlStore) UnlinkBankQuestions(quizId uint, ownerId uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		owned := tx.Model(&BankQuestion{}).Select("id").Where("owner_id = ?", ownerId)
+
+		result := tx.Model(&Question{}).
+			Where("corresponding_quiz_id = ? AND revision_id IS NULL AND bank_question_id IN (?)", quizId, owned).
+			Update("bank_question_id", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		return tx.Model(&Quiz{}).Where("id = ?", quizId).Update("version", gorm.Expr("version + 1")).Error
+	})
+}
+
+func (s *MySqlStore) PostQuizActivities(activities []QuizActivity) error {
+	if err := s.db.Omit("Account").Create(&activities).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *MySqlStore) GetQuizActivities(quizId uint, page *PageRequest) ([]QuizActivity, *PageInfo, error) {
+	return findPage(s.db.Where("quiz_id = ?", quizId), page, activityPages, "Account")
+}
+
+func (s *MySqlStore) PostBankQuestion(question *BankQuestion) error {
+	if err := s.db.Create(question).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PutBankQuestion saves the question with its answers and tags and brings the questions
+// linked to it up to date. Only the working copies of quizzes that can be edited follow,
+// published revisions and quizzes in review or archived keep what they have
+func (s *MySqlStore) PutBankQuestion(question *BankQuestion) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Answers", "Tags").Save(question).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(question).Association("Tags").Replace(question.Tags); err != nil {
+			return err
+		}
+
+		if err := tx.Where("bank_question_id = ?", question.Id).Delete(&BankAnswer{}).Error; err != nil {
+			return err
+		}
+
+		for i := range question.Answers {
+			question.Answers[i].Id = 0
+			question.Answers[i].BankQuestionId = question.Id
+		}
+
+		if len(question.Answers) > 0 {
+			if err := tx.Create(&question.Answers).Error; err != nil {
+				return err
+			}
+		}
+
+		editable := tx.Model(&Quiz{}).Select("id").Where("status IN ?", []string{QuizDraft, QuizPublished})
+
+		var linked []Question
+		if err := tx.Where("bank_question_id = ? AND revision_id IS NULL AND corresponding_quiz_id IN (?)", question.Id, editable).
+			Find(&linked).Error; err != nil {
+			return err
+		}
+
+		quizIds := make([]uint, 0, len(linked))
+		for _, linkedQuestion := range linked {
+			quizIds = append(quizIds, linkedQuestion.CorrespondingQuizId)
+		}
+		if len(quizIds) > 0 {
+			if err := tx.Model(&Quiz{}).Where("id IN ?", quizIds).Update("version", gorm.Expr("version + 1")).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, linkedQuestion := range linked {
+			if err := tx.Where("corresponding_question_id = ?", linkedQuestion.Id).Delete(&Answer{}).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Model(&linkedQuestion).Select("text", "time", "media_id", "translations").Updates(Question{
+				Text:         question.Text,
+				Time:         question.Time,
+				MediaId:      question.MediaId,
+				Translations: question.Translations,
+			}).Error; err != nil {
+				return err
+			}
+
+			answers := make([]Answer, 0, len(question.Answers))
+			for _, answer := range question.Answers {
+				answers = append(answers, Answer{
+					Text:                    answer.Text,
+					IsRight:                 answer.IsRight,
+					Points:                  answer.Points,
+					MediaId:                 answer.MediaId,
+					Translations:            answer.Translations,
+					CorrespondingQuestionId: linkedQuestion.Id,
+				})
+			}
+
+			if len(answers) > 0 {
+				if err := tx.Create(&answers).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *MySqlStore) GetBankQuestionById(id uint) (*BankQuestion, error) {
+	var question BankQuestion
+
+	if err := s.db.Preload("Answers").Preload("Tags").First(&question, id).Error; err != nil {
+		return nil, err
+	}
+
+	return &question, nil
+}
+
+func (s *MySqlStore) GetBankQuestionsByIds(ids []uint) ([]BankQuestion, error) {
+	var questions []BankQuestion
+
+	if err := s.db.Preload("Answers").Preload("Tags").Where("id IN ?", ids).Find(&questions).Error; err != nil {
+		return nil, err
+	}
+
+	return questions, nil
+}
+
+func (s *MySqlStore) GetBankQuestions(ownerId uint, filter *BankFilter, page *PageRequest) ([]BankQuestion, *PageInfo, error) {
+	return findPage(s.bankQuestionQuery(ownerId, filter), page, bankQuestionPages, "Answers", "Tags")
+}
+
+func (s *MySqlStore) GetBankQuestionIds(ownerId uint, filter *BankFilter) ([]uint, error) {
+	var ids []uint
+
+	if err := s.bankQuestionQuery(ownerId, filter).Model(&BankQuestion{}).Order("id").Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// bankQuestionQuery matches the questions of the bank that pass the filter
+func (s *MySqlStore) bankQuestionQuery(ownerId uint, filter *BankFilter) *gorm.DB {
+	query := s.db.Where("owner_id = ?", ownerId)
+	if filter.Difficulty != "" {
+		query = query.Where("difficulty = ?", filter.Difficulty)
+	}
+	if len(filter.Tags) > 0 {
+		tagged := s.db.Table("bank_question_tags").Select("bank_question_tags.bank_question_id").
+			Joins("JOIN tags ON tags.id = bank_question_tags.tag_id").
+			Where("tags.name IN ?", filter.Tags).
+			Group("bank_question_tags.bank_question_id").
+			Having("COUNT(DISTINCT tags.id) = ?", len(filter.Tags))
+		query = query.Where("id IN (?)", tagged)
+	}
+
+	return query
+}
+
+// DeleteBankQuestionById removes the question from the bank, the quiz questions linked to
+// it keep their content and are no longer linked
+func (s *MySqlStore) DeleteBankQuestionById(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Question{}).Where("bank_question_id = ?", id).Update("bank_question_id", nil).Error; err != nil {
+			return err
+		}
+
+		question := BankQuestion{Id: id}
+		if err := tx.Model(&question).Association("Tags").Clear(); err != nil {
+			return err
+		}
+
+		if err := tx.Select("Answers").Delete(&question).Error; err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s *MySqlStore) PostAnswerAudit(audit *AnswerAudit) error {
+	if err := s.db.Create(audit).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *MySqlStore) PutAnswerAudit(audit *AnswerAudit) error {
+	if err := s.db.Save(audit).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *MySqlStore) GetAnswerAuditById(id uint) (*AnswerAudit, error) {
+	var audit AnswerAudit
+
+	if err := s.db.First(&audit, id).Error; err != nil {
+		return nil, err
+	}
+
+	return &audit, nil
+}
+
+func (s *MySqlStore) GetAnswerAudits(includeReviewed bool, page *PageRequest) ([]AnswerAudit, *PageInfo, error) {
+	query := s.db
+	if !includeReviewed {
+		query = query.Where("is_reviewed = ?", false)
+	}
+
+	return findPage(query, page, auditPages, "Player")
+}
+
+func (s *MySqlStore) PostGameAnswer(answer *GameAnswer) error {
+	if err := s.db.Create(answer).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *MySqlStore) GetGameAnswersByGameIds(ids []uint) ([]GameAnswer, error) {
+	var answers []GameAnswer
+
+	if len(ids) == 0 {
+		return answers, nil
+	}
+
+	if err := s.db.Where("game_id IN ?", ids).Order("id").Find(&answers).Error; err != nil {
+		return nil, err
+	}
+
+	return answers, nil
+}
+
+// GetPlayedGamesByRevisionId returns the finished games of the revision with their scores,
+// lobbies that expired before the first question are left out
+func (s *MySqlStore) GetPlayedGamesByRevisionId(revisionId uint) ([]Game, error) {
+	var games []Game
+
+	if err := s.db.Preload("Stats.Player").Where("revision_id = ? AND is_active = ? AND current_question > ?", revisionId, false, 0).
+		Order("id").Find(&games).Error; err != nil {
+		return nil, err
+	}
+
+	return games, nil
+}
+
+func (s *MySqlStore) Close() error {
+	sqlDb, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDb.Close()
+}
+
 func NewMySqlStore() error {
-	database, err := gorm.Open(mysql.Open("root:parola@tcp(127.0.0.1:3306)/quizzland?charset=utf8mb4&parseTime=True&loc=Local"), &gorm.Config{})
+	database, err := gorm.Open(mysql.Open("root:parola@tcp(127.0.0.1:3306)/quizzland?charset=utf8mb4&parseTime=True&loc=Local"), &gorm.Config{TranslateError: true})
 	if err != nil {
 		return err
 	}
 
-	database.AutoMigrate(&Account{}, &Product{}, &Question{}, &Answer{}, &Quiz{}, &Rating{}, &Comment{}, &Stat{}, &Game{})
+	// Quizzes stored before revisions and statuses existed were playable and for sale as
+	// they were
+	hadRevisions := database.Migrator().HasTable(&QuizRevision{})
+	hadStatus := database.Migrator().HasColumn(&Quiz{}, "Status")
+
+	if err := database.AutoMigrate(&Account{}, &Product{}, &Question{}, &Answer{}, &Quiz{}, &Rating{}, &Comment{}, &Stat{}, &Game{}, &AnswerAudit{}, &QuizRevision{}, &Purchase{}, &Media{}, &Category{}, &Tag{}, &BankQuestion{}, &BankAnswer{}, &QuizCollaborator{}, &QuizActivity{}, &GameAnswer{}); err != nil {
+		return err
+	}
 
 	Db = MySqlStore{db: database}
 
+	if !hadRevisions {
+		if err := Db.createInitialRevisions(); err != nil {
+			return err
+		}
+	}
+
+	if !hadStatus {
+		if err := Db.db.Model(&Quiz{}).Where("1 = 1").Update("status", QuizPublished).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createInitialRevisions publishes the working copy of every quiz without a revision as
+// revision 1 and pins the purchases and games of the quiz to it
+func (s *MySqlStore) createInitialRevisions() error {
+	var ids []uint
+	if err := s.db.Model(&Quiz{}).Where("latest_revision = ?", 0).Order("id").Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		quiz, err := s.GetQuizWithQuestions(id)
+		if err != nil {
+			return err
+		}
+
+		revision := QuizRevision{
+			QuizId:       quiz.Id,
+			Number:       1,
+			Name:         quiz.Name,
+			Description:  quiz.Description,
+			Questions:    copyQuestions(quiz.Questions, quiz.Id),
+			Language:     quiz.Language,
+			Translations: quiz.Translations,
+		}
+
+		err = s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&revision).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Model(&Quiz{}).Where("id = ?", quiz.Id).Update("latest_revision", revision.Number).Error; err != nil {
+				return err
+			}
+
+			// The revision columns were added without a default, a zero would break their
+			// foreign keys, so older purchases and games have none
+			if err := tx.Model(&Purchase{}).Where("quiz_id = ? AND revision_id IS NULL", quiz.Id).Update("revision_id", revision.Id).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Model(&Game{}).Where("quiz_id = ? AND revision_id IS NULL", quiz.Id).Update("revision_id", revision.Id).Error; err != nil {
+				return err
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
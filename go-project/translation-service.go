@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// translate returns the text in the language. A missing translation falls back to the
+// base language, pt for pt-BR, and then to the text in the default language
+func translate(text string, translations TextTranslations, language string) string {
+	if language == "" || len(translations) == 0 {
+		return text
+	}
+
+	if translated, ok := translations[language]; ok {
+		return translated
+	}
+
+	if base, _, found := strings.Cut(language, "-"); found {
+		if translated, ok := translations[base]; ok {
+			return translated
+		}
+	}
+
+	return text
+}
+
+// hasTranslations tells whether the question or any of its answers is translated
+func hasTranslations(question Question) bool {
+	if len(question.Translations) > 0 {
+		return true
+	}
+
+	for _, answer := range question.Answers {
+		if len(answer.Translations) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// playerLanguages returns the preferred language of every player of the game
+func playerLanguages(game *Game) map[uint]string {
+	languages := make(map[uint]string, len(game.Stats))
+	for _, stat := range game.Stats {
+		languages[stat.PlayerId] = stat.Player.Language
+	}
+
+	return languages
+}
+
+// CreateQuestionDtoInLanguage creates the question with its text and answers in the
+// language, falling back to the default language where a translation is missing
+func CreateQuestionDtoInLanguage(question Question, language string) *QuestionDto {
+	dto := CreateQuestionDto(question)
+	dto.Text = translate(question.Text, question.Translations, language)
+	for i, answer := range question.Answers {
+		dto.Answers[i].Text = translate(answer.Text, answer.Translations, language)
+	}
+
+	return dto
+}
+
+func sortedLanguages[T any](translations map[string]T) []string {
+	languages := make([]string, 0, len(translations))
+	for language := range translations {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+
+	return languages
+}
+
+// withoutEmpty returns nil for translations without entries, so a quiz saved with {} is
+// the same as one saved without translations
+func withoutEmpty[M ~map[string]V, V any](translations M) M {
+	if len(translations) == 0 {
+		return nil
+	}
+
+	return translations
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -10,11 +11,12 @@ const (
 	Nuser = "nuser"
 	Ruser = "ruser"
 	Admin = "admin"
+	Buser = "buser"
 )
 
 type UserContext struct {
-    Role   string
-    UserID uint
+	Role   string
+	UserID uint
 }
 
 type Claims struct {
@@ -35,6 +37,8 @@ type Account struct {
 	IsInGame    bool    `json:"isInGame"`
 	Quizzes     []Quiz  `json:"quizzes" gorm:"foreignKey:OwnerId"`
 	Role        string  `json:"role" gorm:"size:5"`
+	// Language is the language the player wants questions in, like en or pt-BR
+	Language string `json:"language" gorm:"size:8"`
 }
 
 type AccountDto struct {
@@ -46,6 +50,7 @@ type AccountDto struct {
 	Description string    `json:"description"`
 	Balance     float32   `json:"balance"`
 	Quizzes     []QuizDto `json:"quizzes"`
+	Language    string    `json:"language"`
 }
 
 type Question struct {
@@ -55,27 +60,70 @@ type Question struct {
 	Answers             []Answer `json:"answers" gorm:"foreignKey:CorrespondingQuestionId"`
 	CorrespondingQuizId uint     `json:"-"`
 	CorrespondingQuiz   Quiz     `json:"correspondingQuiz" gorm:"foreignKey:CorrespondingQuizId;references:Id"`
+	// RevisionId is only set on the copies of the question kept by a published revision
+	RevisionId *uint  `json:"-" gorm:"index"`
+	MediaId    *uint  `json:"mediaId"`
+	Media      *Media `json:"-" gorm:"foreignKey:MediaId;references:Id"`
+	// BankQuestionId links the question to the bank question it follows, copies are not linked
+	BankQuestionId *uint            `json:"bankQuestionId" gorm:"index"`
+	Translations   TextTranslations `json:"translations,omitempty" gorm:"serializer:json;type:text"`
 }
 
+// TextTranslations maps a language like en or pt-BR to the text in that language. The
+// text in the default language of the quiz is kept outside of it
+type TextTranslations map[string]string
+
+// QuizTranslation is the name and description of a quiz in another language
+type QuizTranslation struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type QuizTranslations map[string]QuizTranslation
+
 type QuestionDto struct {
 	Id      uint        `json:"id"`
 	Text    string      `json:"text"`
 	Time    uint        `json:"time"`
+	Media   *MediaDto   `json:"media,omitempty"`
 	Answers []AnswerDto `json:"answers"`
 }
 
 type Answer struct {
-	Id                      uint     `json:"id" gorm:"primaryKey"`
-	Points                  uint     `json:"points"`
-	Text                    string   `json:"text" gorm:"size:255"`
-	IsRight                 bool     `json:"isRight"`
-	CorrespondingQuestionId uint     `json:"-"`
-	CorrespondingQuestion   Question `json:"correspondingQuestion" gorm:"foreignKey:CorrespondingQuestionId;references:Id"`
+	Id                      uint             `json:"id" gorm:"primaryKey"`
+	Points                  uint             `json:"points"`
+	Text                    string           `json:"text" gorm:"size:255"`
+	IsRight                 bool             `json:"isRight"`
+	CorrespondingQuestionId uint             `json:"-"`
+	CorrespondingQuestion   Question         `json:"correspondingQuestion" gorm:"foreignKey:CorrespondingQuestionId;references:Id"`
+	MediaId                 *uint            `json:"mediaId"`
+	Media                   *Media           `json:"-" gorm:"foreignKey:MediaId;references:Id"`
+	Translations            TextTranslations `json:"translations,omitempty" gorm:"serializer:json;type:text"`
 }
 
 type AnswerDto struct {
-	Id   uint   `json:"id"`
-	Text string `json:"text"`
+	Id    uint      `json:"id"`
+	Text  string    `json:"text"`
+	Media *MediaDto `json:"media,omitempty"`
+}
+
+// Media is an uploaded image or audio clip, its content is kept in the blob store under Key
+type Media struct {
+	Id          uint      `json:"id" gorm:"primaryKey"`
+	Key         string    `json:"-" gorm:"size:32;uniqueIndex"`
+	Kind        string    `json:"kind" gorm:"size:8"`
+	ContentType string    `json:"contentType" gorm:"size:32"`
+	Size        int64     `json:"size"`
+	OwnerId     uint      `json:"-" gorm:"index"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type MediaDto struct {
+	Id          uint   `json:"id"`
+	Url         string `json:"url"`
+	Kind        string `json:"kind"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
 }
 
 type Quiz struct {
@@ -85,13 +133,244 @@ type Quiz struct {
 	Questions   []Question `json:"questions" gorm:"foreignKey:CorrespondingQuizId"`
 	OwnerId     uint       `json:"-"`
 	Owner       Account    `json:"owner" gorm:"foreignKey:OwnerId;references:Id"`
+	// LatestRevision is the number of the last published revision, 0 before the first one
+	LatestRevision uint      `json:"latestRevision" gorm:"not null;default:0"`
+	Status         string    `json:"status" gorm:"size:10;default:draft;index"`
+	CategoryId     *uint     `json:"-" gorm:"index"`
+	Category       *Category `json:"category" gorm:"foreignKey:CategoryId;references:Id"`
+	Tags           []Tag     `json:"tags" gorm:"many2many:quiz_tags"`
+	Difficulty     string    `json:"difficulty" gorm:"size:8;index"`
+	Language       string    `json:"language" gorm:"size:8;index"`
+	// Source is where a cloned quiz was copied from, it is empty for original quizzes
+	Source QuizSource `json:"source" gorm:"embedded;embeddedPrefix:source_"`
+	// Version grows with every save of the working copy, saves of an older version fail
+	Version uint `json:"version" gorm:"not null;default:0"`
+	// Translations hold the name and description in other languages than Language
+	Translations QuizTranslations `json:"translations,omitempty" gorm:"serializer:json;type:text"`
+}
+
+// QuizSource attributes a clone to the quiz and revision it was copied from. The author
+// is kept by name so the attribution survives the source quiz
+type QuizSource struct {
+	QuizId   *uint  `json:"quizId" gorm:"index"`
+	Revision uint   `json:"revision"`
+	Name     string `json:"name" gorm:"size:30"`
+	Author   string `json:"author" gorm:"size:32"`
+	// Licensed clones contain the work of another author and cannot be sold
+	Licensed bool `json:"licensed"`
 }
 
 type QuizDto struct {
-	Id          uint   `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Owner       string `json:"owner"`
+	Id             uint             `json:"id"`
+	Name           string           `json:"name"`
+	Description    string           `json:"description"`
+	Owner          string           `json:"owner"`
+	LatestRevision uint             `json:"latestRevision"`
+	Status         string           `json:"status"`
+	CategoryId     *uint            `json:"categoryId"`
+	Category       string           `json:"category"`
+	Tags           []string         `json:"tags"`
+	Difficulty     string           `json:"difficulty"`
+	Language       string           `json:"language"`
+	Source         *QuizSource      `json:"source,omitempty"`
+	Version        uint             `json:"version"`
+	Translations   QuizTranslations `json:"translations,omitempty"`
+	// Access is the role of the caller on the quiz, empty when it is only public to them
+	Access string `json:"access,omitempty"`
+}
+
+// QuizCollaborator is a co-author of a quiz with the editor or viewer role
+type QuizCollaborator struct {
+	Id        uint      `json:"id" gorm:"primaryKey"`
+	QuizId    uint      `json:"-" gorm:"uniqueIndex:idx_quiz_collaborator"`
+	AccountId uint      `json:"-" gorm:"uniqueIndex:idx_quiz_collaborator"`
+	Account   Account   `json:"-" gorm:"foreignKey:AccountId;references:Id"`
+	Role      string    `json:"role" gorm:"size:8"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type QuizCollaboratorDto struct {
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type CollaboratorRequest struct {
+	Role string `json:"role"`
+}
+
+// QuizActivity is an entry of the activity log of a quiz, Path points at the question or
+// answer that was changed
+type QuizActivity struct {
+	Id        uint      `json:"id" gorm:"primaryKey"`
+	QuizId    uint      `json:"-" gorm:"index"`
+	AccountId uint      `json:"-"`
+	Account   Account   `json:"-" gorm:"foreignKey:AccountId;references:Id"`
+	Action    string    `json:"action" gorm:"size:24"`
+	Path      string    `json:"path" gorm:"size:64"`
+	Detail    string    `json:"detail" gorm:"size:64"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type QuizActivityDto struct {
+	Username  string    `json:"username"`
+	Action    string    `json:"action"`
+	Path      string    `json:"path,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Category is a node of the category tree admins maintain for the marketplace
+type Category struct {
+	Id       uint       `json:"id" gorm:"primaryKey"`
+	Name     string     `json:"name" gorm:"size:32"`
+	ParentId *uint      `json:"parentId" gorm:"index"`
+	Parent   *Category  `json:"-" gorm:"foreignKey:ParentId;references:Id"`
+	Children []Category `json:"-" gorm:"foreignKey:ParentId"`
+}
+
+type CategoryDto struct {
+	Id       uint          `json:"id"`
+	Name     string        `json:"name"`
+	ParentId *uint         `json:"parentId"`
+	Children []CategoryDto `json:"children"`
+}
+
+// Tag is a free-form label, tags are stored lower case and shared between quizzes
+type Tag struct {
+	Id   uint   `json:"id" gorm:"primaryKey"`
+	Name string `json:"name" gorm:"size:32;uniqueIndex"`
+}
+
+// BankQuestion is a question of the personal question bank of an author, quizzes use it
+// by reference or by copy
+type BankQuestion struct {
+	Id           uint             `json:"id" gorm:"primaryKey"`
+	OwnerId      uint             `json:"-" gorm:"index"`
+	Text         string           `json:"text" gorm:"size:32"`
+	Time         uint             `json:"time"`
+	MediaId      *uint            `json:"mediaId"`
+	Answers      []BankAnswer     `json:"answers" gorm:"foreignKey:BankQuestionId"`
+	Tags         []Tag            `json:"tags" gorm:"many2many:bank_question_tags"`
+	Difficulty   string           `json:"difficulty" gorm:"size:8;index"`
+	CreatedAt    time.Time        `json:"createdAt"`
+	Translations TextTranslations `json:"translations,omitempty" gorm:"serializer:json;type:text"`
+}
+
+type BankAnswer struct {
+	Id             uint             `json:"id" gorm:"primaryKey"`
+	BankQuestionId uint             `json:"-" gorm:"index"`
+	Text           string           `json:"text" gorm:"size:255"`
+	IsRight        bool             `json:"isRight"`
+	Points         uint             `json:"points"`
+	MediaId        *uint            `json:"mediaId"`
+	Translations   TextTranslations `json:"translations,omitempty" gorm:"serializer:json;type:text"`
+}
+
+type BankQuestionDto struct {
+	Id uint `json:"id"`
+	QuestionData
+	Tags       []string  `json:"tags"`
+	Difficulty string    `json:"difficulty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type BankQuestionRequest struct {
+	QuestionData
+	Tags       []string `json:"tags"`
+	Difficulty string   `json:"difficulty"`
+}
+
+// BankFilter narrows the questions of a bank, every tag has to be on the question
+type BankFilter struct {
+	Tags       []string
+	Difficulty string
+}
+
+// ComposeQuizRequest adds bank questions to the working copy of a quiz, Mode is reference
+// or copy
+type ComposeQuizRequest struct {
+	QuestionIds []uint `json:"questionIds"`
+	Mode        string `json:"mode"`
+}
+
+// QuizMetadata classifies a quiz, it is not part of its revisions and changes immediately
+type QuizMetadata struct {
+	CategoryId *uint    `json:"categoryId"`
+	Tags       []string `json:"tags"`
+	Difficulty string   `json:"difficulty"`
+	Language   string   `json:"language"`
+}
+
+// ProductFilter narrows the marketplace listing, zero fields do not filter. A category
+// matches its subcategories too and every tag has to be on the quiz
+type ProductFilter struct {
+	CategoryId uint
+	Tags       []string
+	Difficulty string
+	Language   string
+}
+
+type CategoryRequest struct {
+	Name     string `json:"name"`
+	ParentId *uint  `json:"parentId"`
+}
+
+// QuizRevision is an immutable copy of a quiz as it was published. Games and purchases
+// point at a revision so later changes to the quiz do not reach them
+type QuizRevision struct {
+	Id          uint       `json:"id" gorm:"primaryKey"`
+	QuizId      uint       `json:"quizId" gorm:"uniqueIndex:idx_quiz_revision"`
+	Number      uint       `json:"number" gorm:"uniqueIndex:idx_quiz_revision"`
+	Name        string     `json:"name" gorm:"size:30"`
+	Description string     `json:"description" gorm:"size:255"`
+	Questions   []Question `json:"questions" gorm:"foreignKey:RevisionId"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	// Language is the default language of the quiz when the revision was published
+	Language     string           `json:"language" gorm:"size:8"`
+	Translations QuizTranslations `json:"translations,omitempty" gorm:"serializer:json;type:text"`
+}
+
+type QuizRevisionDto struct {
+	Number        uint      `json:"number"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	QuestionCount int       `json:"questionCount"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// QuizDiff lists what changed between two revisions, questions and answers are compared
+// by their position
+type QuizDiff struct {
+	From    uint         `json:"from"`
+	To      uint         `json:"to"`
+	Changes []QuizChange `json:"changes"`
+}
+
+type QuizChange struct {
+	Path string      `json:"path"`
+	Kind string      `json:"kind"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// Purchase is a bought quiz, the buyer keeps playing the revision they paid for until
+// they upgrade
+type Purchase struct {
+	Id         uint         `json:"id" gorm:"primaryKey"`
+	AccountId  uint         `json:"-" gorm:"uniqueIndex:idx_purchase"`
+	QuizId     uint         `json:"-" gorm:"uniqueIndex:idx_purchase"`
+	Quiz       Quiz         `json:"quiz" gorm:"foreignKey:QuizId;references:Id"`
+	RevisionId uint         `json:"-"`
+	Revision   QuizRevision `json:"revision" gorm:"foreignKey:RevisionId;references:Id"`
+	CreatedAt  time.Time    `json:"createdAt"`
+}
+
+type PurchaseDto struct {
+	Quiz             QuizDto   `json:"quiz"`
+	Revision         uint      `json:"revision"`
+	UpgradeAvailable bool      `json:"upgradeAvailable"`
+	PurchasedAt      time.Time `json:"purchasedAt"`
 }
 
 type Rating struct {
@@ -157,16 +436,95 @@ type StatDto struct {
 }
 
 type Game struct {
-	Id              uint    `json:"id" gorm:"primaryKey"`
-	IsActive        bool    `json:"isActive"`
-	IsInProgress    bool    `json:"isInProgress"`
-	Code            string  `json:"code" gorm:"size:6"`
-	CreatorId       uint    `json:"-"`
-	Creator         Account `json:"creator" gorm:"foreignKey:CreatorId;references:Id"`
-	Stats           []Stat  `json:"stats" gorm:"foreignKey:GameId"`
-	QuizId          uint    `json:"-"`
-	ActiveQuiz      Quiz    `json:"activeQuiz" gorm:"foreignKey:QuizId;references:Id"`
-	CurrentQuestion uint    `json:"currentQuestion"`
+	Id           uint    `json:"id" gorm:"primaryKey"`
+	IsActive     bool    `json:"isActive"`
+	IsInProgress bool    `json:"isInProgress"`
+	Code         string  `json:"code" gorm:"size:6"`
+	ActiveCode   *string `json:"-" gorm:"size:6;uniqueIndex"`
+	CreatorId    uint    `json:"-"`
+	Creator      Account `json:"creator" gorm:"foreignKey:CreatorId;references:Id"`
+	Stats        []Stat  `json:"stats" gorm:"foreignKey:GameId"`
+	QuizId       uint    `json:"-"`
+	ActiveQuiz   Quiz    `json:"activeQuiz" gorm:"foreignKey:QuizId;references:Id"`
+	// RevisionId pins the revision of the quiz that is played
+	RevisionId      uint         `json:"-"`
+	Revision        QuizRevision `json:"revision" gorm:"foreignKey:RevisionId;references:Id"`
+	CurrentQuestion uint         `json:"currentQuestion"`
+	IsCheckpointed  bool         `json:"isCheckpointed"`
+	RemainingTime   uint         `json:"remainingTime"`
+	CreatedAt       time.Time    `json:"createdAt"`
+	// Seed drives every shuffle of the game so its order can be reproduced
+	Seed             int64  `json:"seed"`
+	ShuffleQuestions bool   `json:"shuffleQuestions"`
+	AnswerOrder      string `json:"answerOrder" gorm:"size:8"`
+	QuestionCount    uint   `json:"questionCount"`
+}
+
+type AnswerAudit struct {
+	Id             uint      `json:"id" gorm:"primaryKey"`
+	GameId         uint      `json:"gameId"`
+	PlayerId       uint      `json:"-"`
+	Player         Account   `json:"player" gorm:"foreignKey:PlayerId;references:Id"`
+	QuestionId     uint      `json:"questionId"`
+	AnswerId       uint      `json:"answerId"`
+	ResponseTimeMs uint      `json:"responseTimeMs"`
+	Reason         string    `json:"reason" gorm:"size:255"`
+	IsReviewed     bool      `json:"isReviewed"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// GameAnswer is an answer a player gave during a game, kept for the item analysis of the quiz
+type GameAnswer struct {
+	Id             uint      `json:"id" gorm:"primaryKey"`
+	GameId         uint      `json:"gameId" gorm:"index"`
+	PlayerId       uint      `json:"playerId"`
+	QuestionId     uint      `json:"questionId"`
+	AnswerId       uint      `json:"answerId"`
+	ResponseTimeMs uint      `json:"responseTimeMs"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// QuizAnalysisDto describes how the questions of a revision performed in finished games
+type QuizAnalysisDto struct {
+	QuizId    uint                  `json:"quizId"`
+	Revision  uint                  `json:"revision"`
+	Games     int                   `json:"games"`
+	Players   int                   `json:"players"`
+	Questions []QuestionAnalysisDto `json:"questions"`
+}
+
+// QuestionAnalysisDto holds the statistics of a question. Percentages are of the players
+// the question was asked to, Discrimination is nil while too few players took part
+type QuestionAnalysisDto struct {
+	QuestionId        uint                `json:"questionId"`
+	Position          int                 `json:"position"`
+	Text              string              `json:"text"`
+	Players           int                 `json:"players"`
+	Answered          int                 `json:"answered"`
+	PercentCorrect    float64             `json:"percentCorrect"`
+	AverageResponseMs float64             `json:"averageResponseMs"`
+	Discrimination    *float64            `json:"discrimination"`
+	Answers           []AnswerAnalysisDto `json:"answers"`
+}
+
+type AnswerAnalysisDto struct {
+	AnswerId        uint    `json:"answerId"`
+	Text            string  `json:"text"`
+	IsRight         bool    `json:"isRight"`
+	Selected        int     `json:"selected"`
+	PercentSelected float64 `json:"percentSelected"`
+}
+
+type AnswerAuditDto struct {
+	Id             uint      `json:"id"`
+	GameId         uint      `json:"gameId"`
+	PlayerName     string    `json:"playerName"`
+	QuestionId     uint      `json:"questionId"`
+	AnswerId       uint      `json:"answerId"`
+	ResponseTimeMs uint      `json:"responseTimeMs"`
+	Reason         string    `json:"reason"`
+	IsReviewed     bool      `json:"isReviewed"`
+	CreatedAt      time.Time `json:"createdAt"`
 }
 
 type CreateAccountRequest struct {
@@ -185,6 +543,7 @@ type ModifyAccountRequest struct {
 	LastName    string `json:"lastName"`
 	Email       string `json:"email"`
 	Description string `json:"description"`
+	Language    string `json:"language"`
 }
 
 type DepositRequest struct {
@@ -192,9 +551,55 @@ type DepositRequest struct {
 }
 
 type CreateQuizRequest struct {
-	Name        string     `json:"name"`
-	Description string     `json:"description"`
-	Questions   []Question `json:"questions"`
+	Name         string           `json:"name"`
+	Description  string           `json:"description"`
+	Questions    []Question       `json:"questions"`
+	Translations QuizTranslations `json:"translations"`
+	QuizMetadata
+}
+
+// HtmlImportRules are the CSS selectors used to find a quiz in an HTML document. Question
+// text, answers and right answers are looked up inside every element matched by Question
+type HtmlImportRules struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Question     string `json:"question"`
+	QuestionText string `json:"questionText"`
+	Answer       string `json:"answer"`
+	RightAnswer  string `json:"rightAnswer"`
+	Time         uint   `json:"time"`
+	Points       uint   `json:"points"`
+}
+
+// QuizData is a quiz without ids and relations, as it is imported and exported
+type QuizData struct {
+	Name         string           `json:"name"`
+	Description  string           `json:"description"`
+	Translations QuizTranslations `json:"translations,omitempty"`
+	Questions    []QuestionData   `json:"questions"`
+}
+
+type QuestionData struct {
+	Text         string           `json:"text"`
+	Time         uint             `json:"time"`
+	MediaId      *uint            `json:"mediaId,omitempty"`
+	Translations TextTranslations `json:"translations,omitempty"`
+	Answers      []AnswerData     `json:"answers"`
+}
+
+type AnswerData struct {
+	Text         string           `json:"text"`
+	IsRight      bool             `json:"isRight"`
+	Points       uint             `json:"points"`
+	MediaId      *uint            `json:"mediaId,omitempty"`
+	Translations TextTranslations `json:"translations,omitempty"`
+}
+
+// QuizImportPreview is what an import detected, QuizId is only set once it was saved
+type QuizImportPreview struct {
+	QuizId uint `json:"quizId,omitempty"`
+	QuizData
+	Warnings []string `json:"warnings"`
 }
 
 type ModifyQuizRequest struct {
@@ -202,6 +607,10 @@ type ModifyQuizRequest struct {
 	Name        string     `json:"name"`
 	Description string     `json:"description"`
 	Questions   []Question `json:"questions"`
+	// Version is the version of the quiz the changes were made to
+	Version      uint             `json:"version"`
+	Translations QuizTranslations `json:"translations"`
+	QuizMetadata
 }
 
 type LoginRequest struct {
@@ -234,7 +643,39 @@ type BuyQuizRequest struct {
 }
 
 type CreateGameRequest struct {
-	QuizId uint `json:"quizId"`
+	QuizId      uint `json:"quizId"`
+	NumericCode bool `json:"numericCode"`
+	// Revision lets the owner play an older revision, buyers play the one they bought
+	Revision uint `json:"revision"`
+	// ShuffleQuestions plays the questions in a random order
+	ShuffleQuestions bool `json:"shuffleQuestions"`
+	// AnswerOrder is empty for the stored order, global or player
+	AnswerOrder string `json:"answerOrder"`
+	// QuestionCount draws a random subset of the questions, 0 plays all of them
+	QuestionCount uint `json:"questionCount"`
+	// Seed reproduces the order of an earlier game, a random one is used when not set
+	Seed *int64 `json:"seed"`
+}
+
+// CreateRandomGameRequest starts a game with Count questions drawn from the question bank
+// of the creator
+type CreateRandomGameRequest struct {
+	Count       uint     `json:"count"`
+	Tags        []string `json:"tags"`
+	Difficulty  string   `json:"difficulty"`
+	NumericCode bool     `json:"numericCode"`
+	AnswerOrder string   `json:"answerOrder"`
+	Seed        *int64   `json:"seed"`
+}
+
+type CreateGameResponse struct {
+	Code string `json:"code"`
+}
+
+type AddBotsRequest struct {
+	Count      uint           `json:"count"`
+	Difficulty string         `json:"difficulty"`
+	Custom     *BotDifficulty `json:"custom"`
 }
 
 type SellQuizRequest struct {
@@ -245,6 +686,25 @@ type SellQuizRequest struct {
 type Event struct {
 	Type    string          `json:"type"`
 	Payload json.RawMessage `json:"payload"`
+	// RequestId is set by the client and echoed in the ack or error reply
+	RequestId string `json:"requestId,omitempty"`
+}
+
+type HelloEvent struct {
+	ProtocolVersion   int   `json:"protocolVersion"`
+	SupportedVersions []int `json:"supportedVersions,omitempty"`
+	// Encoding is the encoding the server picked from the client's websocket subprotocols
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type AckEvent struct {
+	RequestId string `json:"requestId"`
+}
+
+type ErrorEvent struct {
+	RequestId string `json:"requestId"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
 }
 
 type SendAnswerEvent struct {
@@ -252,7 +712,17 @@ type SendAnswerEvent struct {
 	QuestionId string `json:"questionId"`
 }
 
+type ServerShutdownEvent struct {
+	Message string `json:"message"`
+}
+
 type NextRoundEvent struct {
 	Stats    []StatDto   `json:"stats"`
 	Question QuestionDto `json:"question"`
+	// SentAt is the unix time in milliseconds the round was broadcast
+	SentAt int64 `json:"sentAt"`
+}
+
+type GameOverEvent struct {
+	Stats []StatDto `json:"stats"`
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits of a quiz, the lengths follow the sizes of the columns they are stored in
+const (
+	maxQuizNameLength     = 30
+	maxDescriptionLength  = 255
+	maxQuestionTextLength = 32
+	maxAnswerTextLength   = 255
+	maxAnswersPerQuestion = 10
+	minQuestionTime       = 5
+	maxQuestionTime       = 600
+)
+
+// ValidationError points at the field a quiz breaks a rule at, imported documents also
+// report the line
+type ValidationError struct {
+	Line    int    `json:"line,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors is returned when a quiz is not valid, the API answers it with 422
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		switch {
+		case err.Line > 0:
+			messages = append(messages, fmt.Sprintf("line %d: %s", err.Line, err.Message))
+		case err.Field != "":
+			messages = append(messages, fmt.Sprintf("%s: %s", err.Field, err.Message))
+		default:
+			messages = append(messages, err.Message)
+		}
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// quizValidator collects every broken rule instead of stopping at the first one
+type quizValidator struct {
+	errs  ValidationErrors
+	lines []int
+}
+
+func (v *quizValidator) add(question int, field string, message string) {
+	err := ValidationError{Field: field, Message: message}
+	if question >= 0 && question < len(v.lines) {
+		err.Line = v.lines[question]
+	}
+
+	v.errs = append(v.errs, err)
+}
+
+func (v *quizValidator) text(question int, field string, value string, max int, what string) {
+	length := utf8.RuneCountInString(value)
+	switch {
+	case strings.TrimSpace(value) == "":
+		v.add(question, field, what+" has no text")
+	case length > max:
+		v.add(question, field, fmt.Sprintf("%s is %d characters long, at most %d are allowed", what, length, max))
+	}
+}
+
+// translations checks that every translation is in a valid language and follows the same
+// rules as the text it translates, prefix is put in front of the field paths
+func (v *quizValidator) translations(question int, prefix string, translations TextTranslations, max int, what string) {
+	for _, language := range sortedLanguages(translations) {
+		field := prefix + "translations." + language
+		if !languagePattern.MatchString(language) {
+			v.add(question, field, "language must be a code like en or pt-BR")
+			continue
+		}
+
+		v.text(question, field, translations[language], max, what)
+	}
+}
+
+// ValidateQuizData checks a quiz before it is saved, imported or published. Lines holds
+// the line each question starts at for formats that have them
+func ValidateQuizData(data *QuizData, lines []int) ValidationErrors {
+	v := quizValidator{lines: lines}
+
+	v.text(-1, "name", data.Name, maxQuizNameLength, "quiz name")
+	if length := utf8.RuneCountInString(data.Description); length > maxDescriptionLength {
+		v.add(-1, "description", fmt.Sprintf("description is %d characters long, at most %d are allowed", length, maxDescriptionLength))
+	}
+
+	for _, language := range sortedLanguages(data.Translations) {
+		field := "translations." + language
+		if !languagePattern.MatchString(language) {
+			v.add(-1, field, "language must be a code like en or pt-BR")
+			continue
+		}
+
+		translation := data.Translations[language]
+		v.text(-1, field+".name", translation.Name, maxQuizNameLength, "quiz name")
+		if length := utf8.RuneCountInString(translation.Description); length > maxDescriptionLength {
+			v.add(-1, field+".description", fmt.Sprintf("description is %d characters long, at most %d are allowed", length, maxDescriptionLength))
+		}
+	}
+
+	if len(data.Questions) == 0 {
+		v.add(-1, "questions", "quiz has no questions")
+	}
+
+	for i, question := range data.Questions {
+		v.question(i, fmt.Sprintf("questions[%d].", i), question)
+	}
+
+	return v.errs
+}
+
+// ValidateQuestionData checks a single question, like the ones kept in a question bank
+func ValidateQuestionData(question *QuestionData) ValidationErrors {
+	v := quizValidator{}
+	v.question(-1, "", *question)
+	return v.errs
+}
+
+// question checks the question at index i, prefix is put in front of its field paths
+func (v *quizValidator) question(i int, prefix string, question QuestionData) {
+	v.text(i, prefix+"text", question.Text, maxQuestionTextLength, "question")
+	v.translations(i, prefix, question.Translations, maxQuestionTextLength, "question")
+
+	if question.Time == 0 {
+		v.add(i, prefix+"time", "question has no time")
+	} else if question.Time < minQuestionTime || question.Time > maxQuestionTime {
+		v.add(i, prefix+"time", fmt.Sprintf("question time must be between %d and %d seconds", minQuestionTime, maxQuestionTime))
+	}
+
+	switch {
+	case len(question.Answers) == 0:
+		v.add(i, prefix+"answers", "question has no answers")
+	case len(question.Answers) > maxAnswersPerQuestion:
+		v.add(i, prefix+"answers", fmt.Sprintf("question has more than %d answers", maxAnswersPerQuestion))
+	case !hasRightAnswer(question):
+		v.add(i, prefix+"answers", "question has no right answer")
+	}
+
+	for j, answer := range question.Answers {
+		answerPath := fmt.Sprintf("%sanswers[%d]", prefix, j)
+
+		v.text(i, answerPath+".text", answer.Text, maxAnswerTextLength, "answer")
+		v.translations(i, answerPath+".", answer.Translations, maxAnswerTextLength, "answer")
+		if !answer.IsRight && answer.Points > 0 {
+			v.add(i, answerPath+".points", "wrong answers cannot give points")
+		}
+	}
+}